@@ -0,0 +1,167 @@
+package kindle_quiz_bot
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// answerGrade is the result of the guess evaluation, stored with the answer.
+type answerGrade int
+
+const (
+	gradeIncorrect answerGrade = iota
+	gradeAlmostCorrect
+	gradeCorrect
+)
+
+// articles are stripped from the beginning of the answer,
+// so "the house" and "das Haus" are accepted.
+var articles = map[string][]string{
+	"en": {"the", "a", "an"},
+	"de": {"der", "die", "das", "den", "dem", "des", "ein", "eine", "einen", "einem", "einer", "eines"},
+	"fr": {"le", "la", "les", "l", "un", "une", "des"},
+	"es": {"el", "la", "los", "las", "un", "una", "unos", "unas"},
+}
+
+var foldedLetters = strings.NewReplacer("ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l")
+
+// evaluateAnswer compares the guess with the expected answer in the language lc.
+// Answers with missing diacritics or a few typos are almost correct.
+func evaluateAnswer(guess, expected, lc string) answerGrade {
+	e := normalizeAnswer(expected, lc)
+	if e == "" {
+		//Nothing is left after normalization, e.g. the answer is punctuation
+		if compareWords(guess, expected) {
+			return gradeCorrect
+		}
+		return gradeIncorrect
+	}
+
+	g := normalizeAnswer(guess, lc)
+	if g == e {
+		return gradeCorrect
+	}
+
+	fg := foldDiacritics(g)
+	fe := foldDiacritics(e)
+	if fg == fe {
+		return gradeAlmostCorrect
+	}
+
+	if editDistance(fg, fe) <= maxTypos(len([]rune(fe))) || isTransposition(fg, fe) {
+		return gradeAlmostCorrect
+	}
+
+	return gradeIncorrect
+}
+
+// normalizeAnswer lower-cases the answer in NFC form,
+// strips punctuation and the leading article.
+func normalizeAnswer(s, lc string) string {
+	s = norm.NFC.String(strings.ToLower(s))
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return ' '
+		}
+		return r
+	}, s)
+
+	words := strings.Fields(s)
+	if len(words) > 1 && isArticle(words[0], lc) {
+		words = words[1:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+func isArticle(w, lc string) bool {
+	for _, a := range articles[lc] {
+		if w == a {
+			return true
+		}
+	}
+	return false
+}
+
+// foldDiacritics removes accents and umlauts, "Häuser" becomes "Hauser".
+func foldDiacritics(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return foldedLetters.Replace(norm.NFC.String(b.String()))
+}
+
+// maxTypos is the edit distance tolerated for the answer of n letters.
+// Words shorter than 5 letters differ from other real words by a letter,
+// "bank" and "bonk", so only swapped letters are forgiven in them.
+func maxTypos(n int) int {
+	switch {
+	case n < 5:
+		return 0
+	case n < 9:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// isTransposition is true if the strings differ only by two adjacent letters swapped.
+func isTransposition(s1, s2 string) bool {
+	a := []rune(s1)
+	b := []rune(s2)
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		return i+1 < len(a) && a[i] == b[i+1] && a[i+1] == b[i] && string(a[i+2:]) == string(b[i+2:])
+	}
+	return false
+}
+
+// editDistance is Damerau-Levenshtein distance, swapped letters count as one typo.
+func editDistance(s1, s2 string) int {
+	a := []rune(s1)
+	b := []rune(s2)
+
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,98 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestEvaluateAnswer(t *testing.T) {
+	cases := []struct {
+		guess    string
+		expected string
+		lc       string
+		grade    answerGrade
+	}{
+		{" House! ", "house", "en", gradeCorrect},
+		{"the house", "house", "en", gradeCorrect},
+		{"das Haus", "Haus", "de", gradeCorrect},
+		{"Hand", "Haus", "de", gradeIncorrect},
+		{"Hauser", "Häuser", "de", gradeAlmostCorrect},
+		{"Strasse", "Straße", "de", gradeAlmostCorrect},
+		{"hosue", "house", "en", gradeAlmostCorrect},
+		{"hous", "house", "en", gradeAlmostCorrect},
+		{"cat", "car", "en", gradeIncorrect},
+		{"bonk", "bank", "en", gradeIncorrect},
+		{"horse", "house", "en", gradeAlmostCorrect},
+		{"mouse", "house", "en", gradeAlmostCorrect},
+		{"bnak", "bank", "en", gradeAlmostCorrect},
+		{"apartment", "house", "en", gradeIncorrect},
+		{"apartmen", "apartment", "en", gradeAlmostCorrect},
+		{"appartmant", "apartment", "en", gradeAlmostCorrect},
+		{"apartheid", "apartment", "en", gradeIncorrect},
+		{"the", "the", "en", gradeCorrect},
+		{"!@#$%", "foobar", "en", gradeIncorrect},
+		// Decomposed "é" is equal to the composed one
+		{"cafe\u0301", "café", "fr", gradeCorrect},
+	}
+
+	for _, c := range cases {
+		grade := evaluateAnswer(c.guess, c.expected, c.lc)
+		if grade != c.grade {
+			t.Fatalf("Invalid grade for %q, expected %q: %v", c.guess, c.expected, grade)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		s1, s2   string
+		distance int
+	}{
+		{"haus", "haus", 0},
+		{"haus", "hasu", 1},
+		{"haus", "hause", 1},
+		{"häus", "haus", 1},
+		{"", "haus", 4},
+	}
+
+	for _, c := range cases {
+		if d := editDistance(c.s1, c.s2); d != c.distance {
+			t.Fatalf("Invalid distance between %q and %q: %d", c.s1, c.s2, d)
+		}
+	}
+}
+
+func TestIsTransposition(t *testing.T) {
+	cases := []struct {
+		s1, s2   string
+		expected bool
+	}{
+		{"hosue", "house", true},
+		{"ohuse", "house", true},
+		{"house", "house", false},
+		{"mouse", "house", false},
+		{"hoseu", "house", false},
+		{"hous", "house", false},
+	}
+
+	for _, c := range cases {
+		if isTransposition(c.s1, c.s2) != c.expected {
+			t.Fatalf("Invalid transposition of %q and %q", c.s1, c.s2)
+		}
+	}
+}
+
+func TestAlmostCorrectIsNotCorrect(t *testing.T) {
+	p := guessParams{word{word: "Haus", stem: "Haus"}, "hosue", 0, forwardDirection, translationQuestion, "en", 0, noRating}
+	r := guessResult{p, "house", nil}
+	if r.grade() != gradeAlmostCorrect || r.correct() || r.quality() != qualityPassed {
+		t.Fatalf("Answer with a typo should pass, but not be correct: %v", r.grade())
+	}
+}
+
+func TestChoiceGuessIsExact(t *testing.T) {
+	p := guessParams{word{word: "Haus", stem: "Haus"}, "horse", 0, forwardDirection, choiceQuestion, "en", 0, noRating}
+	r := guessResult{p, "house", nil}
+	if r.correct() {
+		t.Fatalf("Chosen option can't be a typo")
+	}
+}
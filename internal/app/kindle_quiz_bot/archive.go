@@ -0,0 +1,171 @@
+package kindle_quiz_bot
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// uploadDirPrefix names per-job temporary directories of uploads.
+const uploadDirPrefix = "kindle_quiz_upload_"
+
+var (
+	zipHeader  = []byte("PK\x03\x04")
+	gzipHeader = []byte{0x1f, 0x8b}
+
+	// uploadNames are names of the files importers read,
+	// archives may have other files along with them.
+	uploadNames = []string{"vocab.db", "My Clippings.txt", "KoboReader.sqlite", "vocabulary_builder.sqlite3"}
+)
+
+// createUploadDir creates temporary directory for the job files.
+func createUploadDir(userId int) (string, error) {
+	return ioutil.TempDir("", uploadDirPrefix+strconv.Itoa(userId)+"_")
+}
+
+// removeUpload removes uploaded file along with its job directory,
+// files of older uploads are kept in the working directory.
+func removeUpload(path string) error {
+	dir := filepath.Dir(path)
+	if strings.HasPrefix(filepath.Base(dir), uploadDirPrefix) {
+		return os.RemoveAll(dir)
+	}
+	return os.Remove(path)
+}
+
+// unpackUpload unpacks zip or gzip archive into the directory of the upload
+// and returns path of the unpacked file, other files are returned as they are.
+func unpackUpload(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(zipHeader))
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, zipHeader):
+		return unzipUpload(path)
+	case bytes.HasPrefix(header, gzipHeader):
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+		return gunzipUpload(f, filepath.Dir(path))
+	}
+
+	return path, nil
+}
+
+func unzipUpload(path string) (string, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return "", invalidFile("The zip archive is corrupted, please pack the file again.")
+	}
+	defer r.Close()
+
+	entry, err := uploadEntry(r.File)
+	if err != nil {
+		return "", err
+	}
+
+	if entry.UncompressedSize64 > maxVocabFileSize {
+		return "", invalidFile("The file in the archive is too large: %d MB, max size is %d MB.", entry.UncompressedSize64>>20, maxVocabFileSize>>20)
+	}
+
+	src, err := entry.Open()
+	if err != nil {
+		return "", invalidFile("The zip archive is corrupted, please pack the file again.")
+	}
+	defer src.Close()
+
+	return writeUnpacked(src, filepath.Dir(path), entry.Name)
+}
+
+// uploadEntry returns the archive file to import: the file with
+// known name or the only file of the archive.
+func uploadEntry(files []*zip.File) (*zip.File, error) {
+	regular := make([]*zip.File, 0, len(files))
+	for _, f := range files {
+		if f.FileInfo().IsDir() || strings.HasPrefix(filepath.Base(f.Name), ".") {
+			continue
+		}
+		regular = append(regular, f)
+	}
+
+	for _, f := range regular {
+		for _, name := range uploadNames {
+			if strings.EqualFold(safeFileName(f.Name), name) {
+				return f, nil
+			}
+		}
+	}
+
+	if len(regular) == 1 {
+		return regular[0], nil
+	}
+
+	if len(regular) == 0 {
+		return nil, invalidFile("The zip archive is empty.")
+	}
+
+	return nil, invalidFile("The zip archive has several files, pack only vocab.db, My Clippings.txt, KoboReader.sqlite or vocabulary_builder.sqlite3.")
+}
+
+func gunzipUpload(r io.Reader, dir string) (string, error) {
+	src, err := gzip.NewReader(r)
+	if err != nil {
+		return "", invalidFile("The gzip archive is corrupted, please pack the file again.")
+	}
+	defer src.Close()
+
+	return writeUnpacked(src, dir, src.Name)
+}
+
+// writeUnpacked writes at most maxVocabFileSize bytes of the archive file into the directory,
+// archive paths are dropped, so files can't be written outside of it.
+func writeUnpacked(src io.Reader, dir, name string) (string, error) {
+	path := filepath.Join(dir, "unpacked_"+safeFileName(name))
+
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		//TODO: error handle
+		_ = out.Close()
+	}()
+
+	//Sizes in archive headers can't be trusted
+	n, err := io.Copy(out, io.LimitReader(src, maxVocabFileSize+1))
+	if err != nil {
+		return "", invalidFile("The archive is corrupted, please pack the file again.")
+	}
+
+	if n > maxVocabFileSize {
+		return "", invalidFile("The file in the archive is too large, max size is %d MB.", maxVocabFileSize>>20)
+	}
+
+	return path, nil
+}
+
+// safeFileName returns base name of the archive path, "upload" for empty names.
+func safeFileName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + strings.Replace(name, "\\", "/", -1)))
+	if name == "/" || name == "." || name == ".." {
+		return "upload"
+	}
+	return name
+}
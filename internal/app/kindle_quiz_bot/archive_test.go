@@ -0,0 +1,124 @@
+package kindle_quiz_bot
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnpackUpload(t *testing.T) {
+	dir, err := createUploadDir(0)
+	if err != nil {
+		t.Fatalf("Couldn't create upload dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	vocab, err := ioutil.ReadFile("../../../test/data/vocab.db")
+	if err != nil {
+		t.Fatalf("Couldn't read vocab.db: %v", err)
+	}
+
+	zipped := filepath.Join(dir, "upload.zip")
+	writeTestZip(t, zipped, map[string][]byte{
+		"__MACOSX/._vocab.db":   []byte("resource fork"),
+		"../../system/vocab.db": vocab,
+		"readme.txt":            []byte("readme"),
+	})
+
+	gzipped := filepath.Join(dir, "upload.gz")
+	f, err := os.Create(gzipped)
+	if err != nil {
+		t.Fatalf("Couldn't create gzip: %v", err)
+	}
+	w := gzip.NewWriter(f)
+	w.Name = "../vocab.db"
+	_, err = w.Write(vocab)
+	_ = w.Close()
+	_ = f.Close()
+	if err != nil {
+		t.Fatalf("Couldn't write gzip: %v", err)
+	}
+
+	for _, path := range []string{zipped, gzipped} {
+		unpacked, err := unpackUpload(path)
+		if err != nil {
+			t.Fatalf("Couldn't unpack %s: %v", path, err)
+		}
+
+		if filepath.Dir(unpacked) != dir {
+			t.Fatalf("File unpacked outside of upload dir: %s", unpacked)
+		}
+
+		err = validateVocabFile(unpacked)
+		if err != nil {
+			t.Fatalf("Unpacked file rejected: %v", err)
+		}
+	}
+
+	plain := "../../../test/data/vocab.db"
+	unpacked, err := unpackUpload(plain)
+	if err != nil || unpacked != plain {
+		t.Fatalf("Plain file should be returned as is, got %s: %v", unpacked, err)
+	}
+
+	ambiguous := filepath.Join(dir, "ambiguous.zip")
+	writeTestZip(t, ambiguous, map[string][]byte{"a.db": vocab, "b.db": vocab})
+
+	_, err = unpackUpload(ambiguous)
+	verr, ok := err.(*validationError)
+	if !ok || !strings.Contains(verr.reason, "several files") {
+		t.Fatalf("Expected validation error for archive with several files, got %v", err)
+	}
+}
+
+func TestRemoveUpload(t *testing.T) {
+	dir, err := createUploadDir(0)
+	if err != nil {
+		t.Fatalf("Couldn't create upload dir: %v", err)
+	}
+
+	path := filepath.Join(dir, "upload")
+	err = ioutil.WriteFile(path, []byte("upload"), 0600)
+	if err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	err = removeUpload(path)
+	if err != nil {
+		t.Fatalf("Couldn't remove upload: %v", err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Upload dir should be removed: %v", err)
+	}
+}
+
+func writeTestZip(t *testing.T, path string, files map[string][]byte) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Couldn't create zip: %v", err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, data := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Couldn't add %s to zip: %v", name, err)
+		}
+
+		_, err = fw.Write(data)
+		if err != nil {
+			t.Fatalf("Couldn't write %s to zip: %v", name, err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("Couldn't close zip: %v", err)
+	}
+}
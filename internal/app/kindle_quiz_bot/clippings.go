@@ -0,0 +1,340 @@
+package kindle_quiz_bot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	clippingsSeparator = "=========="
+	clippingsProfile   = "clippings"
+	maxClippingWords   = 3
+)
+
+type clippingKind int
+
+const (
+	unknownClipping clippingKind = iota
+	highlightClipping
+	noteClipping
+	bookmarkClipping
+)
+
+// clipping is an entry of Kindle "My Clippings.txt" file.
+type clipping struct {
+	title    string
+	author   string
+	kind     clippingKind
+	page     string
+	location string
+	addedAt  time.Time
+	text     string
+}
+
+var (
+	clippingPageRe     = regexp.MustCompile(`(?i)\b(?:page|seite)\s+([\w-]+)`)
+	clippingLocationRe = regexp.MustCompile(`(?i)\b(?:location|loc\.|position|pos\.)\s+([\d-]+)`)
+	clippingEditionRe  = regexp.MustCompile(`(?i)\((\w+) edition\)`)
+
+	clippingKinds = []struct {
+		kind     clippingKind
+		keywords []string
+	}{
+		{highlightClipping, []string{"highlight", "markierung"}},
+		{noteClipping, []string{"note", "notiz"}},
+		{bookmarkClipping, []string{"bookmark", "lesezeichen"}},
+	}
+
+	clippingDatePrefixes = []string{"added on ", "hinzugefügt am "}
+
+	clippingDateLayouts = []string{
+		"January 2, 2006 3:04:05 PM",
+		"January 2, 2006, 3:04:05 PM",
+		"January 2, 2006 3:04 PM",
+		"2 January 2006 15:04:05",
+		"2. January 2006 15:04:05",
+		"2 January 06 15:04:05",
+	}
+
+	germanMonths = strings.NewReplacer(
+		"Januar ", "January ", "Februar ", "February ", "März ", "March ", "Mai ", "May ",
+		"Juni ", "June ", "Juli ", "July ", "Oktober ", "October ", "Dezember ", "December ",
+	)
+
+	//Kindle book titles end with "(German Edition)" and alike
+	editionLanguages = map[string]string{
+		"english":    "en",
+		"german":     "de",
+		"french":     "fr",
+		"spanish":    "es",
+		"italian":    "it",
+		"portuguese": "pt",
+		"dutch":      "nl",
+		"russian":    "ru",
+	}
+)
+
+// parseClippings reads entries of "My Clippings.txt", entries
+// which couldn't be parsed are skipped.
+func parseClippings(r io.Reader) ([]clipping, error) {
+	clippings := make([]clipping, 0)
+	lines := make([]string, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		line = strings.TrimPrefix(line, "\uFEFF")
+
+		if strings.TrimSpace(line) != clippingsSeparator {
+			lines = append(lines, line)
+			continue
+		}
+
+		c, ok := parseClipping(lines)
+		if ok {
+			clippings = append(clippings, c)
+		}
+		lines = lines[:0]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("clippings: %v", err.Error())
+	}
+
+	return clippings, nil
+}
+
+func parseClipping(lines []string) (clipping, bool) {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+
+	if len(lines) < 2 || !strings.HasPrefix(lines[1], "- ") {
+		return clipping{}, false
+	}
+
+	c := clipping{}
+	c.title, c.author = parseClippingTitle(strings.TrimSpace(lines[0]))
+
+	meta := strings.TrimPrefix(lines[1], "- ")
+	parts := strings.Split(meta, " | ")
+
+	first := strings.ToLower(parts[0])
+	for _, k := range clippingKinds {
+		for _, keyword := range k.keywords {
+			if c.kind == unknownClipping && strings.Contains(first, keyword) {
+				c.kind = k.kind
+			}
+		}
+	}
+
+	if m := clippingPageRe.FindStringSubmatch(meta); m != nil {
+		c.page = m[1]
+	}
+
+	if m := clippingLocationRe.FindStringSubmatch(meta); m != nil {
+		c.location = m[1]
+	}
+
+	for _, p := range parts {
+		for _, prefix := range clippingDatePrefixes {
+			if strings.HasPrefix(strings.ToLower(p), prefix) {
+				c.addedAt = parseClippingDate(p[len(prefix):])
+			}
+		}
+	}
+
+	c.text = strings.TrimSpace(strings.Join(lines[2:], "\n"))
+
+	return c, c.kind != unknownClipping
+}
+
+// parseClippingTitle splits "Title (Author)" line.
+func parseClippingTitle(line string) (title, author string) {
+	if !strings.HasSuffix(line, ")") {
+		return line, ""
+	}
+
+	i := strings.LastIndex(line, "(")
+	if i <= 0 {
+		return line, ""
+	}
+
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1 : len(line)-1])
+}
+
+// parseClippingDate returns zero time for unknown date formats.
+func parseClippingDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+
+	//Weekday goes first and isn't needed
+	if i := strings.Index(s, ", "); i >= 0 && !strings.ContainsAny(s[:i], "0123456789") {
+		s = s[i+2:]
+	}
+	s = germanMonths.Replace(s)
+
+	for _, layout := range clippingDateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// clippingWord returns highlighted word or short phrase
+// without surrounding punctuation, ok is false for longer highlights.
+func clippingWord(c clipping) (string, bool) {
+	if c.kind != highlightClipping {
+		return "", false
+	}
+
+	text := strings.TrimFunc(c.text, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)
+	})
+
+	words := strings.Fields(text)
+	if len(words) == 0 || len(words) > maxClippingWords {
+		return "", false
+	}
+
+	return strings.Join(words, " "), true
+}
+
+// clippingsLanguage guesses language of the book from its title.
+func clippingsLanguage(title string) string {
+	m := clippingEditionRe.FindStringSubmatch(title)
+	if m == nil {
+		return ""
+	}
+	return editionLanguages[strings.ToLower(m[1])]
+}
+
+func readClippingsFile(path string) ([]clipping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseClippings(f)
+}
+
+// validateClippingsFile checks "My Clippings.txt" has highlighted words to import.
+func validateClippingsFile(path string) error {
+	clippings, err := readClippingsFile(path)
+	if err != nil {
+		return err
+	}
+
+	if len(clippings) == 0 {
+		return invalidFile("The file has no clippings, it doesn't look like My Clippings.txt.")
+	}
+
+	for _, c := range clippings {
+		if _, ok := clippingWord(c); ok {
+			return nil
+		}
+	}
+
+	return invalidFile("The file has no highlighted words. Highlight words or short phrases up to %d words on your Kindle and send My Clippings.txt again.", maxClippingWords)
+}
+
+// clippingsVocabulary turns short highlights into words linked to their books.
+// Words of books with unknown language get defaultLang.
+func clippingsVocabulary(clippings []clipping, defaultLang string) vocabulary {
+	v := vocabulary{}
+	books := make(map[string]bool)
+
+	for _, c := range clippings {
+		text, ok := clippingWord(c)
+		if !ok {
+			continue
+		}
+
+		lc := clippingsLanguage(c.title)
+		if lc == "" {
+			lc = defaultLang
+		}
+
+		var timestamp int64
+		if !c.addedAt.IsZero() {
+			timestamp = c.addedAt.UnixNano() / int64(time.Millisecond)
+		}
+
+		key := clippingsProfile + ":" + c.title + ":" + c.author
+		if !books[key] {
+			books[key] = true
+			v.books = append(v.books, book{key: key, title: c.title, authors: c.author, lang: lc})
+		}
+
+		w := vocabWord{word: text, stem: text, lc: lc, timestamp: timestamp}
+		v.words = append(v.words, w)
+		v.lookups = append(v.lookups, vocabLookup{word: w, bookKey: key, pos: c.location, timestamp: timestamp})
+	}
+
+	return v
+}
+
+// readClippingsVocabulary reads words highlighted after user's import progress,
+// returns the vocabulary and count of all highlighted words in the file.
+func readClippingsVocabulary(path string, userId int, repo *repository) (*vocabulary, int, error) {
+	clippings, err := readClippingsFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defaultLang, err := repo.getUserSourceLang(userId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	all := clippingsVocabulary(clippings, defaultLang)
+
+	progress, err := repo.getImportProgress(userId, clippingsProfile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	v := vocabulary{books: all.books}
+	for i, w := range all.words {
+		//Highlights without date are imported every time, import skips duplicates
+		if w.timestamp != 0 && w.timestamp <= progress.wordTimestamp {
+			continue
+		}
+
+		v.words = append(v.words, w)
+		v.lookups = append(v.lookups, all.lookups[i])
+
+		if w.timestamp > progress.wordTimestamp {
+			progress.wordTimestamp = w.timestamp
+		}
+	}
+	progress.lookupTimestamp = progress.wordTimestamp
+	v.progress = []importProgress{*progress}
+
+	return &v, len(all.words), nil
+}
+
+func migrateFromClippings(path string, userId int, repo *repository) (importStats, error) {
+	v, _, err := readClippingsVocabulary(path, userId, repo)
+	if err != nil {
+		return importStats{}, err
+	}
+
+	v.fileHash, err = fileHash(path)
+	if err != nil {
+		return importStats{}, err
+	}
+
+	return repo.importVocabulary(userId, *v)
+}
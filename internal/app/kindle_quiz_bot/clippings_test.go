@@ -0,0 +1,81 @@
+package kindle_quiz_bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testClippings = "\uFEFFDer Ruf der Tagesfische (German Edition) (Maren Gottschalk)\r\n" +
+	"- Your Highlight on page 12 | Location 171-171 | Added on Monday, May 7, 2018 9:31:14 PM\r\n" +
+	"\r\n" +
+	"sperrte,\r\n" +
+	"==========\r\n" +
+	"Der Ruf der Tagesfische (German Edition) (Maren Gottschalk)\r\n" +
+	"- Ihre Notiz auf Seite 12 | Position 171 | Hinzugefügt am Dienstag, 8. Mai 2018 10:02:44\r\n" +
+	"\r\n" +
+	"a note\r\n" +
+	"==========\r\n" +
+	"The Call of Cthulhu (H. P. Lovecraft)\r\n" +
+	"- Your Highlight at location 45-47 | Added on Sunday, 15 May 2016 14:20:29\r\n" +
+	"\r\n" +
+	"The most merciful thing in the world is the inability of the human mind.\r\n" +
+	"==========\r\n" +
+	"The Call of Cthulhu (H. P. Lovecraft)\r\n" +
+	"- Your Bookmark at location 50 | Added on Sunday, 15 May 2016 14:21:00\r\n" +
+	"\r\n" +
+	"\r\n" +
+	"==========\r\n"
+
+func TestParseClippings(t *testing.T) {
+	clippings, err := parseClippings(strings.NewReader(testClippings))
+	if err != nil {
+		t.Fatalf("Couldn't parse clippings: %v", err)
+	}
+
+	if len(clippings) != 4 {
+		t.Fatalf("Invalid clippings count: %d", len(clippings))
+	}
+
+	c := clippings[0]
+	if c.title != "Der Ruf der Tagesfische (German Edition)" || c.author != "Maren Gottschalk" {
+		t.Fatalf("Invalid title: %q by %q", c.title, c.author)
+	}
+
+	if c.kind != highlightClipping || c.page != "12" || c.location != "171-171" || c.text != "sperrte," {
+		t.Fatalf("Invalid highlight: %+v", c)
+	}
+
+	if !c.addedAt.Equal(time.Date(2018, time.May, 7, 21, 31, 14, 0, time.UTC)) {
+		t.Fatalf("Invalid date: %v", c.addedAt)
+	}
+
+	if clippings[1].kind != noteClipping || clippings[1].addedAt.Month() != time.May || clippings[1].location != "171" {
+		t.Fatalf("Invalid note: %+v", clippings[1])
+	}
+
+	if clippings[3].kind != bookmarkClipping || clippings[3].addedAt.Year() != 2016 {
+		t.Fatalf("Invalid bookmark: %+v", clippings[3])
+	}
+}
+
+func TestClippingsVocabulary(t *testing.T) {
+	clippings, err := parseClippings(strings.NewReader(testClippings))
+	if err != nil {
+		t.Fatalf("Couldn't parse clippings: %v", err)
+	}
+
+	v := clippingsVocabulary(clippings, "en")
+
+	if len(v.words) != 1 || v.words[0].word != "sperrte" || v.words[0].lc != "de" {
+		t.Fatalf("Invalid words: %+v", v.words)
+	}
+
+	if len(v.lookups) != 1 || v.lookups[0].bookKey != v.books[0].key || v.lookups[0].pos != "171-171" {
+		t.Fatalf("Invalid lookups: %+v", v.lookups)
+	}
+
+	if len(v.books) != 1 || v.books[0].authors != "Maren Gottschalk" || v.books[0].lang != "de" {
+		t.Fatalf("Invalid books: %+v", v.books)
+	}
+}
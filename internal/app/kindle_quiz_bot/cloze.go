@@ -0,0 +1,45 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// questionKind is a type of the question, cloze questions are answered
+// with the word, so they are scheduled in reverse direction.
+// Choice questions are answered with the option, so typos aren't tolerated.
+// Flashcards are answered with the rating.
+type questionKind int
+
+const (
+	translationQuestion questionKind = iota
+	clozeQuestion
+	choiceQuestion
+	flashcardQuestion
+)
+
+// clozeQuestion returns the sentence from the book with the word blanked out,
+// false is returned if the word has no sentence or the sentence has no word.
+func (q *quiz) clozeQuestion(r guessRequest, l *lang) (string, bool, error) {
+	lookup, err := q.repo.getLookup(r.userId, r.word.id)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	sentence, ok := clozeSentence(lookup.usage, r.word.word)
+	if !ok {
+		return "", false, nil
+	}
+
+	return fmt.Sprintf("Fill in the missing %s word:\n\n%s", l.englishName, sentence), true, nil
+}
+
+func clozeSentence(usage, w string) (string, bool) {
+	usage = strings.TrimSpace(usage)
+	sentence := maskWord(usage, w)
+	return sentence, usage != "" && sentence != usage
+}
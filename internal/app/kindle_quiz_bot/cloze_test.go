@@ -0,0 +1,27 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestClozeSentence(t *testing.T) {
+	sentence, ok := clozeSentence(" Er sperrte die Tür ab. ", "sperrte")
+	if !ok || sentence != "Er ___ die Tür ab." {
+		t.Fatalf("Invalid cloze sentence: %s", sentence)
+	}
+
+	_, ok = clozeSentence("Er schloss die Tür ab.", "sperrte")
+	if ok {
+		t.Fatalf("Sentence without the word can't be cloze")
+	}
+
+	_, ok = clozeSentence("Nothing is here", "in")
+	if ok {
+		t.Fatalf("Word inside other words can't be cloze")
+	}
+
+	_, ok = clozeSentence("", "sperrte")
+	if ok {
+		t.Fatalf("Empty usage can't be cloze")
+	}
+}
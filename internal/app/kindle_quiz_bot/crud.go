@@ -4,12 +4,20 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"log"
+	"strings"
+	"time"
 )
 
 var (
-	errNoWordsFound = errors.New("no words found for user")
+	errNoWordsFound  = errors.New("no words found for user")
+	errBatchNotFound = errors.New("import batch not found")
+	errNoJobs        = errors.New("no queued jobs")
+	errNoDispute     = errors.New("no answer to dispute")
+	errNotReviewed   = errors.New("dispute not found or already reviewed")
+	errSessionActive = errors.New("session is already active")
+	errNoSession     = errors.New("no active session")
 )
 
 type userState int
@@ -20,6 +28,8 @@ const (
 	readyForQuestion
 	migrationInProgress
 	awaitingLanguage
+	awaitingProfile
+	awaitingConfirmation
 )
 
 type repository struct {
@@ -88,7 +98,7 @@ func (repo *repository) updateUserLang(userID, langId int) error {
 }
 
 func (repo *repository) createUser(userID int) (*user, error) {
-	u := user{userID, readyForQuestion}
+	u := user{id: userID, currentState: readyForQuestion, showContext: true}
 
 	_, err := repo.db.Exec(`
 		INSERT INTO users (id) 
@@ -121,6 +131,130 @@ func (repo *repository) setLastWord(userID int, w word) error {
 	return nil
 }
 
+func (repo *repository) setQuestionOptions(userID int, options []string) error {
+	_, err := repo.db.Exec("UPDATE questions SET options=$2 WHERE user_id=$1", userID, pq.Array(options))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (repo *repository) setQuestionKind(userID int, kind questionKind) error {
+	_, err := repo.db.Exec("UPDATE questions SET kind=$2 WHERE user_id=$1", userID, kind)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (repo *repository) getQuestionOptions(userID int) ([]string, error) {
+	var options []string
+	err := repo.db.QueryRow("SELECT options FROM questions WHERE user_id=$1", userID).Scan(pq.Array(&options))
+	if err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// getDistractors returns random user's words in the language of the word.
+func (repo *repository) getDistractors(userID int, w word, count int) ([]word, error) {
+	rows, err := repo.db.Query(`
+		SELECT w.id, w.word, w.stem, w.lang 
+		FROM user_words uw 
+		JOIN words w ON w.id = uw.word_id 
+		WHERE uw.user_id=$1 AND w.lang=$2 AND w.id <> $3 
+		ORDER BY random() 
+		LIMIT $4`, userID, w.langId, w.id, count)
+	if err != nil {
+		return nil, fmt.Errorf("get distractors: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	words := make([]word, 0, count)
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		d := word{}
+		err = rows.Scan(&d.id, &d.word, &d.stem, &d.langId)
+		if err != nil {
+			return nil, fmt.Errorf("get distractors: %v", err.Error())
+		}
+		words = append(words, d)
+	}
+
+	return words, nil
+}
+
+func (repo *repository) setQuizDirection(userID int, direction quizDirection) error {
+	_, err := repo.db.Exec("UPDATE users SET quiz_direction=$2 WHERE id=$1", userID, direction)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// addQuestionHint counts the hint taken for the current question, the number of hints is returned.
+func (repo *repository) addQuestionHint(userID int) (int, error) {
+	var hints int
+	err := repo.db.QueryRow("UPDATE questions SET hints = hints + 1 WHERE user_id=$1 RETURNING hints", userID).Scan(&hints)
+	if err != nil {
+		return 0, err
+	}
+	return hints, nil
+}
+
+func (repo *repository) getQuestionHints(userID int) (int, error) {
+	var hints int
+	err := repo.db.QueryRow("SELECT hints FROM questions WHERE user_id=$1", userID).Scan(&hints)
+	if err != nil {
+		return 0, err
+	}
+	return hints, nil
+}
+
+func (repo *repository) getQuestionType(userID int) (quizDirection, questionKind, error) {
+	var direction quizDirection
+	var kind questionKind
+	err := repo.db.QueryRow("SELECT direction, kind FROM questions WHERE user_id=$1", userID).Scan(&direction, &kind)
+	if err != nil {
+		return forwardDirection, translationQuestion, err
+	}
+	return direction, kind, nil
+}
+
+func (repo *repository) setMasteryThreshold(userID, threshold int) error {
+	_, err := repo.db.Exec("UPDATE users SET mastery_threshold=$2 WHERE id=$1", userID, threshold)
+	if err != nil {
+		return fmt.Errorf("set mastery threshold: %v", err.Error())
+	}
+	return nil
+}
+
+func (repo *repository) getMasteryThreshold(userID int) (int, error) {
+	var threshold int
+	err := repo.db.QueryRow("SELECT mastery_threshold FROM users WHERE id=$1", userID).Scan(&threshold)
+	if err != nil {
+		return 0, fmt.Errorf("get mastery threshold: %v", err.Error())
+	}
+	return threshold, nil
+}
+
+func (repo *repository) setQuizMode(userID int, mode quizMode) error {
+	_, err := repo.db.Exec("UPDATE users SET quiz_mode=$2 WHERE id=$1", userID, mode)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (repo *repository) getLastWord(userID int) (*word, error) {
 	var wordID int
 	err := repo.db.QueryRow("SELECT word_id FROM questions WHERE user_id=$1", userID).Scan(&wordID)
@@ -131,8 +265,12 @@ func (repo *repository) getLastWord(userID int) (*word, error) {
 	return repo.getWord(wordID)
 }
 
-func (repo *repository) getRandomWord(userID int) (word *word, err error) {
+// getNextWord asks the most overdue word, new words go after the due ones
+// and the words due later are asked only when there is nothing else.
+func (repo *repository) getNextWord(userID int) (word *word, err error) {
 	var wordID int
+	var direction quizDirection
+	var kind questionKind
 
 	tx, err := repo.db.Begin()
 
@@ -149,21 +287,69 @@ func (repo *repository) getRandomWord(userID int) (word *word, err error) {
 		}
 	}()
 
+	//Every word is asked in each direction of user's setting with its own schedule,
+	//cloze questions are asked for the words with usage sentences.
+	//Due words go first, then new and then not yet due ones. Within the group the word
+	//is drawn at random weighted by its error rate, the time since it was asked and how overdue it is.
+	//Retired words are skipped like the words mastered on kindle.
 	err = tx.QueryRow(`
-		SELECT word_id 
-		FROM user_words 
-		WHERE user_id=$1 
-		OFFSET floor(random() * (SELECT COUNT(*) FROM words)) LIMIT 1`, userID).Scan(&wordID)
+		SELECT uw.word_id, d.direction, CASE WHEN u.quiz_mode = $6 THEN $7 WHEN u.quiz_mode = $9 THEN $10 WHEN u.quiz_mode = $11 THEN $12 ELSE $8 END 
+		FROM user_words uw
+		JOIN users u ON u.id = uw.user_id
+		CROSS JOIN LATERAL unnest(CASE 
+		    WHEN u.quiz_mode = $6 THEN ARRAY[$5]::integer[] 
+		    WHEN u.quiz_direction = $3 THEN ARRAY[$4, $5]::integer[] 
+		    ELSE ARRAY[u.quiz_direction] 
+		END) AS d(direction)
+		LEFT JOIN word_schedules ws 
+		    ON ws.user_id = uw.user_id AND ws.word_id = uw.word_id AND ws.direction = d.direction
+		CROSS JOIN LATERAL (SELECT 
+		    (COALESCE(ws.incorrect_answers, 0) + 1.0) / (COALESCE(ws.correct_answers, 0) + COALESCE(ws.incorrect_answers, 0) + 2.0) 
+		    * (1.0 + CASE 
+		        WHEN ws.last_answered_at IS NULL THEN $13::double precision 
+		        ELSE LEAST(EXTRACT(EPOCH FROM now() - ws.last_answered_at) / 3600.0, $13::double precision) 
+		    END / 24.0) 
+		    * (1.0 + CASE 
+		        WHEN ws.due_at < now() THEN LEAST(EXTRACT(EPOCH FROM now() - ws.due_at) / 86400.0, $14::double precision) 
+		        ELSE 0 
+		    END) AS weight
+		) sw
+		WHERE uw.user_id=$1 
+		  AND (uw.category <> $2 OR u.include_mastered)
+		  AND (ws.retired_at IS NULL OR u.include_mastered)
+		  AND (u.quiz_book IS NULL OR EXISTS (
+		      SELECT 1 
+		      FROM lookups l
+		      JOIN books b ON b.user_id = l.user_id AND b.book_key = l.book_key
+		      WHERE l.user_id = uw.user_id AND l.word_id = uw.word_id AND b.id = u.quiz_book))
+		  AND (u.quiz_mode <> $6 OR EXISTS (
+		      SELECT 1 
+		      FROM lookups l 
+		      WHERE l.user_id = uw.user_id AND l.word_id = uw.word_id AND l.usage <> ''))
+		ORDER BY 
+		    CASE 
+		        WHEN ws.due_at <= now() THEN 0 
+		        WHEN ws.due_at IS NULL THEN 1 
+		        ELSE 2 
+		    END, 
+		    -ln(1.0 - random()) / sw.weight 
+		LIMIT 1`, userID, kindleCategoryMastered, mixedDirection, forwardDirection, reverseDirection,
+		clozeMode, clozeQuestion, translationQuestion, choiceMode, choiceQuestion, flashcardMode, flashcardQuestion,
+		maxRecencyHours, maxOverdueDays).Scan(&wordID, &direction, &kind)
 
 	if err == sql.ErrNoRows {
 		return nil, errNoWordsFound
 	}
 
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = tx.Exec(`
-		INSERT INTO questions (user_id, word_id) 
-		VALUES ($1, $2) 
+		INSERT INTO questions (user_id, word_id, direction, kind) 
+		VALUES ($1, $2, $3, $4) 
 		ON CONFLICT (user_id) 
-		    DO UPDATE SET word_id=$2`, userID, wordID)
+		    DO UPDATE SET word_id=$2, direction=$3, kind=$4, options=NULL, hints=0`, userID, wordID, direction, kind)
 
 	if err != nil {
 		return nil, err
@@ -196,7 +382,10 @@ func (repo *repository) getWord(wordID int) (*word, error) {
 func (repo *repository) getUser(id int) (*user, error) {
 	u := user{}
 	var langId int
-	err := repo.db.QueryRow("SELECT * FROM users WHERE id=$1", id).Scan(&u.id, &langId, &u.currentState)
+	err := repo.db.QueryRow(`
+		SELECT id, current_lang, current_state, show_context, quiz_book, include_mastered, quiz_mode, is_reviewer 
+		FROM users 
+		WHERE id=$1`, id).Scan(&u.id, &langId, &u.currentState, &u.showContext, &u.quizBook, &u.includeMastered, &u.quizMode, &u.reviewer)
 
 	if err != nil {
 		return nil, err
@@ -253,114 +442,1302 @@ func (repo *repository) getLanguageWithCode(code string) (*lang, error) {
 	return &l, nil
 }
 
-func (repo *repository) persistAnswer(r guessResult) error {
+// persistAnswer writes the answer and schedules the word, retired is true
+// if the answer made the streak reach the mastery threshold.
+func (repo *repository) persistAnswer(r guessResult) (retired bool, err error) {
 	p := r.params
 
 	tx, err := repo.db.Begin()
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	lang, err := repo.getUserLanguage(r.params.userID)
 	if err != nil {
 		//TODO: error handling
 		_ = tx.Rollback()
-		return err
+		return false, err
 	}
 
 	_, err = tx.Exec(`
-		INSERT INTO answers (word_id, user_id, correct, user_lang, guess) 
-		VALUES ($1, $2, $3, $4, $5)`, p.word.id, p.userID, r.correct(), lang.id, p.guess)
+		INSERT INTO answers (word_id, user_id, correct, user_lang, guess, direction, kind, grade, session_id, hints, rating) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, (SELECT id FROM quiz_sessions WHERE user_id=$2 AND status=$9), $10, NULLIF($11, ''))`,
+		p.word.id, p.userID, r.correct(), lang.id, p.guess, p.direction, p.kind, r.grade(), sessionActive, p.hints, p.rating)
 	if err != nil {
 		_ = tx.Rollback()
-		return err
+		return false, err
+	}
+
+	sched := newSchedule()
+	var dueAt pq.NullTime
+	err = tx.QueryRow(`
+		SELECT ease, interval_days, repetitions, due_at 
+		FROM word_schedules 
+		WHERE user_id=$1 AND word_id=$2 AND direction=$3 
+		FOR UPDATE`, p.userID, p.word.id, p.direction).Scan(&sched.ease, &sched.interval, &sched.repetitions, &dueAt)
+	if err != nil && err != sql.ErrNoRows {
+		_ = tx.Rollback()
+		return false, fmt.Errorf("write answer: %s", err.Error())
 	}
+	sched.dueAt = dueAt.Time
 
-	var field string
+	sched = sched.next(r.quality(), time.Now())
+
+	var correct, incorrect int
 	if r.correct() {
-		field = "correct_answers"
+		correct = 1
 	} else {
-		field = "incorrect_answers"
+		incorrect = 1
+	}
+
+	streak := 0
+	if r.recalled() {
+		streak = 1
+	}
+
+	//Only correct answers without typos and hints keep the streak,
+	//any other answer brings the retired word back
+	_, err = tx.Exec(`
+		INSERT INTO word_schedules 
+		    (user_id, word_id, direction, ease, interval_days, repetitions, due_at, correct_answers, incorrect_answers, 
+		     streak, last_answered_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::integer, now()) 
+		ON CONFLICT (user_id, word_id, direction) 
+		    DO UPDATE SET ease=$4, interval_days=$5, repetitions=$6, due_at=$7, 
+		                  correct_answers = word_schedules.correct_answers + $8, 
+		                  incorrect_answers = word_schedules.incorrect_answers + $9, 
+		                  streak = CASE WHEN $10 = 1 THEN word_schedules.streak + 1 ELSE 0 END, 
+		                  last_answered_at = now(), 
+		                  retired_at = CASE WHEN $10 = 1 THEN word_schedules.retired_at END`,
+		p.userID, p.word.id, p.direction, sched.ease, sched.interval, sched.repetitions, sched.dueAt, correct, incorrect,
+		streak)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, fmt.Errorf("write answer: schedule: %s", err.Error())
 	}
 
-	var queryStr = fmt.Sprintf("UPDATE user_words SET %s = %[1]s + 1 WHERE word_id = %d", field, p.word.id)
+	err = tx.QueryRow(`
+		UPDATE word_schedules ws 
+		SET retired_at = now() 
+		FROM users u 
+		WHERE u.id = ws.user_id AND ws.user_id=$1 AND ws.word_id=$2 AND ws.direction=$3 
+		  AND ws.retired_at IS NULL AND u.mastery_threshold > 0 AND ws.streak >= u.mastery_threshold 
+		RETURNING true`,
+		p.userID, p.word.id, p.direction).Scan(&retired)
+	if err != nil && err != sql.ErrNoRows {
+		_ = tx.Rollback()
+		return false, fmt.Errorf("write answer: retire: %s", err.Error())
+	}
 
-	_, err = tx.Exec(queryStr)
+	_, err = tx.Exec(`
+		UPDATE user_words 
+		SET correct_answers = correct_answers + $3, 
+		    incorrect_answers = incorrect_answers + $4 
+		WHERE user_id=$1 AND word_id=$2`, p.userID, p.word.id, correct, incorrect)
 
 	if err != nil {
 		//TODO: error handling
 		_ = tx.Rollback()
-		return fmt.Errorf("write answer: %s", err.Error())
+		return false, fmt.Errorf("write answer: %s", err.Error())
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return retired, nil
 }
 
-func (repo *repository) addWordForUser(userID int, word word, lc string) (err error){
-	tx, err := repo.db.Begin()
+func (repo *repository) getLookup(userID, wordID int) (*lookup, error) {
+	l := lookup{}
+	err := repo.db.QueryRow(`
+		SELECT id, word_id, usage, COALESCE(book_key, ''), COALESCE(pos, ''), timestamp 
+		FROM lookups 
+		WHERE user_id=$1 AND word_id=$2 AND usage <> '' 
+		ORDER BY timestamp DESC 
+		LIMIT 1`, userID, wordID).Scan(&l.id, &l.wordID, &l.usage, &l.bookKey, &l.pos, &l.timestamp)
 	if err != nil {
-		return fmt.Errorf("postgres tx begin: %v", err.Error())
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (repo *repository) toggleShowContext(userID int) (bool, error) {
+	var showContext bool
+	err := repo.db.QueryRow(`
+		UPDATE users SET show_context = NOT show_context 
+		WHERE id=$1 
+		RETURNING show_context`, userID).Scan(&showContext)
+	if err != nil {
+		return false, err
+	}
+	return showContext, nil
+}
+
+func (repo *repository) toggleIncludeMastered(userID int) (bool, error) {
+	var includeMastered bool
+	err := repo.db.QueryRow(`
+		UPDATE users SET include_mastered = NOT include_mastered 
+		WHERE id=$1 
+		RETURNING include_mastered`, userID).Scan(&includeMastered)
+	if err != nil {
+		return false, err
 	}
+	return includeMastered, nil
+}
 
+func (repo *repository) getBooks(userID int) ([]book, error) {
+	books := make([]book, 0)
+
+	rows, err := repo.db.Query(`
+		SELECT b.id, b.book_key, COALESCE(b.asin, ''), COALESCE(b.title, ''), 
+		       COALESCE(b.authors, ''), COALESCE(b.lang, ''), COUNT(DISTINCT l.word_id)
+		FROM books b
+		LEFT JOIN lookups l ON l.user_id = b.user_id AND l.book_key = b.book_key
+		WHERE b.user_id=$1
+		GROUP BY b.id
+		ORDER BY b.id`, userID)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+
+		err := rows.Err()
 		if err != nil {
-			rollbackErr := tx.Rollback()
-			if rollbackErr != nil {
-				log.Printf("Unable to rollback tx: %v", rollbackErr)
-			}
+			return nil, err
 		}
-	}()
 
-	var langId int
-	err = tx.QueryRow(`
-			SELECT current_lang 
-			FROM users
-			WHERE id=$1`, userID).Scan(&langId)
+		b := book{}
+		err = rows.Scan(&b.id, &b.key, &b.asin, &b.title, &b.authors, &b.lang, &b.wordsCount)
+		if err != nil {
+			return nil, fmt.Errorf("get books: %v", err.Error())
+		}
+		books = append(books, b)
+	}
+
+	return books, nil
+}
+
+// setQuizBook restricts questions to the words from the book,
+// nil bookID resets the restriction.
+func (repo *repository) setQuizBook(userID int, bookID *int) error {
+	_, err := repo.db.Exec("UPDATE users SET quiz_book=$1 WHERE id=$2", bookID, userID)
 	if err != nil {
 		return err
 	}
+	return nil
+}
 
-	var wordID int
-	err = tx.QueryRow(`
-		INSERT INTO words (word, stem, lang)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (word, stem, lang) 
-		    DO UPDATE SET word=$1 RETURNING id`, word.word, word.stem, langId).Scan(&wordID)
+// getImportProgress returns zero progress if profile wasn't imported yet.
+func (repo *repository) getImportProgress(userID int, profileID string) (*importProgress, error) {
+	p := importProgress{profileID: profileID}
+	err := repo.db.QueryRow(`
+		SELECT word_timestamp, lookup_timestamp 
+		FROM import_progress 
+		WHERE user_id=$1 AND profile_id=$2`, userID, profileID).Scan(&p.wordTimestamp, &p.lookupTimestamp)
+	if err == sql.ErrNoRows {
+		return &p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get import progress: %v", err.Error())
+	}
+	return &p, nil
+}
+
+// getUserSourceLang returns code of the language most of user's words are in.
+func (repo *repository) getUserSourceLang(userID int) (string, error) {
+	var code string
+	err := repo.db.QueryRow(`
+		SELECT l.code 
+		FROM user_words uw 
+		JOIN words w ON w.id = uw.word_id 
+		JOIN languages l ON l.id = w.lang 
+		WHERE uw.user_id=$1 AND l.code <> $2 
+		GROUP BY l.code 
+		ORDER BY count(*) DESC, l.code 
+		LIMIT 1`, userID, unknownLangCode).Scan(&code)
+	if err == sql.ErrNoRows {
+		return unknownLangCode, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get user source language: %v", err.Error())
+	}
+	return code, nil
+}
+
+// getProfileChoices returns stored choices of device profiles to import.
+func (repo *repository) getProfileChoices(userID int) (map[string]bool, error) {
+	choices := make(map[string]bool)
 
+	rows, err := repo.db.Query("SELECT profile_id, selected FROM user_profiles WHERE user_id=$1", userID)
 	if err != nil {
-		log.Printf("insertion word: %v\n", err)
-		log.Println("Query existing word id")
-		//If error happened, probably word with same key was already added, trying to get id
-		err = tx.QueryRow(`
-			SELECT id
-			FROM words
-			WHERE word=$1 AND stem=$2 AND lang=$3`, word.word, word.stem, word.langId).Scan(&wordID)
+		return nil, err
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
 
+		err := rows.Err()
 		if err != nil {
-			fmt.Printf("add words for user: %v", err)
-			return err
+			return nil, err
+		}
+
+		var profileID string
+		var selected bool
+		err = rows.Scan(&profileID, &selected)
+		if err != nil {
+			return nil, fmt.Errorf("get profile choices: %v", err.Error())
 		}
+		choices[profileID] = selected
 	}
 
-	_, err = tx.Exec(`
-		INSERT INTO user_words (user_id, word_id)
-		VALUES ($1, $2)
-		ON CONFLICT (user_id, word_id) 
-		    DO NOTHING`, userID, wordID)
+	return choices, nil
+}
 
+func (repo *repository) setProfileChoices(userID int, choices map[string]bool) error {
+	tx, err := repo.db.Begin()
 	if err != nil {
-		return fmt.Errorf("postgre: inserting user_word: %v", err.Error())
+		return err
 	}
 
-	err = tx.Commit()
+	for profileID, selected := range choices {
+		_, err = tx.Exec(`
+			INSERT INTO user_profiles (user_id, profile_id, selected) 
+			VALUES ($1, $2, $3) 
+			ON CONFLICT (user_id, profile_id) 
+			    DO UPDATE SET selected=$3`, userID, profileID, selected)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("set profile choices: %v", err.Error())
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo *repository) deleteProfileChoices(userID int) error {
+	_, err := repo.db.Exec("DELETE FROM user_profiles WHERE user_id=$1", userID)
 	if err != nil {
-		return fmt.Errorf("postgre: tx commit: %v", err.Error())
+		return err
+	}
+	return nil
+}
+
+// setPendingUpload keeps uploaded file waiting for user's decision.
+func (repo *repository) setPendingUpload(userID int, u pendingUpload) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO pending_uploads (user_id, path, profiles) 
+		VALUES ($1, $2, $3) 
+		ON CONFLICT (user_id) 
+		    DO UPDATE SET path=$2, profiles=$3, created_at=now()`, userID, u.path, pq.Array(u.profiles))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (repo *repository) getPendingUpload(userID int) (*pendingUpload, error) {
+	u := pendingUpload{}
+	err := repo.db.QueryRow(`
+		SELECT path, profiles 
+		FROM pending_uploads 
+		WHERE user_id=$1`, userID).Scan(&u.path, pq.Array(&u.profiles))
+	if err != nil {
+		return nil, err
 	}
+	return &u, nil
+}
 
+func (repo *repository) deletePendingUpload(userID int) error {
+	_, err := repo.db.Exec("DELETE FROM pending_uploads WHERE user_id=$1", userID)
+	if err != nil {
+		return err
+	}
 	return nil
 }
+
+// deleteExpiredPendingUploads deletes uploads older than ttl and returns their paths.
+func (repo *repository) deleteExpiredPendingUploads(ttl time.Duration) ([]string, error) {
+	rows, err := repo.db.Query(`
+		DELETE FROM pending_uploads 
+		WHERE created_at < now() - $1 * interval '1 second' 
+		RETURNING path`, ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("delete expired uploads: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	paths := make([]string, 0)
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var path string
+		err = rows.Scan(&path)
+		if err != nil {
+			return nil, fmt.Errorf("delete expired uploads: %v", err.Error())
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// getUserWordKeys returns wordKey of every user's word.
+func (repo *repository) getUserWordKeys(userID int) (map[string]bool, error) {
+	keys := make(map[string]bool)
+
+	rows, err := repo.db.Query(`
+		SELECT w.word, w.stem, l.code 
+		FROM user_words uw
+		JOIN words w ON w.id = uw.word_id
+		JOIN languages l ON l.id = w.lang
+		WHERE uw.user_id=$1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var w, stem, lc string
+		err = rows.Scan(&w, &stem, &lc)
+		if err != nil {
+			return nil, fmt.Errorf("get user word keys: %v", err.Error())
+		}
+		keys[wordKey(w, stem, lc)] = true
+	}
+
+	return keys, nil
+}
+
+// getUserWordCategories returns category of every user's word by wordKey.
+func (repo *repository) getUserWordCategories(userID int) (map[string]int, error) {
+	categories := make(map[string]int)
+
+	rows, err := repo.db.Query(`
+		SELECT w.word, w.stem, l.code, COALESCE(uw.category, 0) 
+		FROM user_words uw
+		JOIN words w ON w.id = uw.word_id
+		JOIN languages l ON l.id = w.lang
+		WHERE uw.user_id=$1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var w, stem, lc string
+		var category int
+		err = rows.Scan(&w, &stem, &lc, &category)
+		if err != nil {
+			return nil, fmt.Errorf("get user word categories: %v", err.Error())
+		}
+		categories[wordKey(w, stem, lc)] = category
+	}
+
+	return categories, nil
+}
+
+func (repo *repository) getImportBatches(userID int) ([]importBatch, error) {
+	batches := make([]importBatch, 0)
+
+	rows, err := repo.db.Query(`
+		SELECT id, created_at, COALESCE(file_hash, ''), words_count, lookups_count 
+		FROM import_batches 
+		WHERE user_id=$1 
+		ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		b := importBatch{}
+		err = rows.Scan(&b.id, &b.createdAt, &b.fileHash, &b.wordsCount, &b.lookupsCount)
+		if err != nil {
+			return nil, fmt.Errorf("get import batches: %v", err.Error())
+		}
+		batches = append(batches, b)
+	}
+
+	return batches, nil
+}
+
+// undoImportBatch removes words, lookups and books the batch introduced along with
+// answers for the removed words. Words which existed before the batch are kept.
+func (repo *repository) undoImportBatch(userID, batchID int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return fmt.Errorf("postgres tx begin: %v", err.Error())
+	}
+
+	defer func() {
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				log.Printf("Unable to rollback tx: %v", rollbackErr)
+			}
+		}
+	}()
+
+	var id int
+	err = tx.QueryRow(`
+		SELECT id 
+		FROM import_batches 
+		WHERE id=$1 AND user_id=$2 
+		FOR UPDATE`, batchID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return errBatchNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		`DELETE FROM answers 
+		 WHERE user_id=$1 AND word_id IN (SELECT word_id FROM user_words WHERE user_id=$1 AND batch_id=$2)`,
+		`DELETE FROM questions 
+		 WHERE user_id=$1 AND word_id IN (SELECT word_id FROM user_words WHERE user_id=$1 AND batch_id=$2)`,
+		`DELETE FROM lookups WHERE user_id=$1 AND batch_id=$2`,
+		`DELETE FROM user_words WHERE user_id=$1 AND batch_id=$2`,
+		`DELETE FROM books b 
+		 WHERE b.user_id=$1 AND b.batch_id=$2 
+		   AND NOT EXISTS (SELECT 1 FROM lookups l WHERE l.user_id = b.user_id AND l.book_key = b.book_key)`,
+		`DELETE FROM import_batches WHERE user_id=$1 AND id=$2`,
+	}
+
+	for _, q := range queries {
+		_, err = tx.Exec(q, userID, batchID)
+		if err != nil {
+			return fmt.Errorf("undo import: %v", err.Error())
+		}
+	}
+
+	//Progress may include the undone rows, next upload walks the whole file again
+	_, err = tx.Exec("DELETE FROM import_progress WHERE user_id=$1", userID)
+	if err != nil {
+		return fmt.Errorf("undo import: reset progress: %v", err.Error())
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("postgre: tx commit: %v", err.Error())
+	}
+
+	return nil
+}
+
+// importVocabulary merges the vocabulary into user's words in a single transaction.
+// Rows are staged with COPY into temporary tables and merged with set-based
+// queries, failed import leaves no data behind.
+func (repo *repository) importVocabulary(userID int, v vocabulary) (stats importStats, err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return stats, fmt.Errorf("postgres tx begin: %v", err.Error())
+	}
+
+	defer func() {
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				log.Printf("Unable to rollback tx: %v", rollbackErr)
+			}
+		}
+	}()
+
+	_, err = tx.Exec(`
+		CREATE TEMP TABLE import_books (
+		    book_key text, asin text, title text, authors text, lang text
+		) ON COMMIT DROP;
+		CREATE TEMP TABLE import_words (
+		    word text, stem text, lang text, category integer, timestamp bigint
+		) ON COMMIT DROP;
+		CREATE TEMP TABLE import_lookups (
+		    word text, stem text, lang text, usage text, book_key text, pos text, timestamp bigint
+		) ON COMMIT DROP`)
+	if err != nil {
+		return stats, fmt.Errorf("import: create staging tables: %v", err.Error())
+	}
+
+	err = copyIn(tx, "import_books", []string{"book_key", "asin", "title", "authors", "lang"}, len(v.books), func(i int) []interface{} {
+		b := v.books[i]
+		return []interface{}{b.key, b.asin, b.title, b.authors, b.lang}
+	})
+	if err != nil {
+		return stats, fmt.Errorf("import: copy books: %v", err.Error())
+	}
+
+	err = copyIn(tx, "import_words", []string{"word", "stem", "lang", "category", "timestamp"}, len(v.words), func(i int) []interface{} {
+		w := v.words[i]
+		return []interface{}{w.word, w.stem, normalizeLangCode(w.lc), w.category, w.timestamp}
+	})
+	if err != nil {
+		return stats, fmt.Errorf("import: copy words: %v", err.Error())
+	}
+
+	err = copyIn(tx, "import_lookups", []string{"word", "stem", "lang", "usage", "book_key", "pos", "timestamp"}, len(v.lookups), func(i int) []interface{} {
+		l := v.lookups[i]
+		return []interface{}{l.word.word, l.word.stem, normalizeLangCode(l.word.lc), l.usage, l.bookKey, l.pos, l.timestamp}
+	})
+	if err != nil {
+		return stats, fmt.Errorf("import: copy lookups: %v", err.Error())
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO import_batches (user_id, file_hash) 
+		VALUES ($1, $2) 
+		RETURNING id`, userID, v.fileHash).Scan(&stats.batchID)
+	if err != nil {
+		return stats, fmt.Errorf("import: create batch: %v", err.Error())
+	}
+
+	//Unknown language codes are added with the code instead of names
+	_, err = tx.Exec(`
+		INSERT INTO languages (code, english_name, localized_name)
+		SELECT DISTINCT lang, lang, lang 
+		FROM (SELECT lang FROM import_words UNION SELECT lang FROM import_lookups) l
+		ON CONFLICT (code) 
+		    DO NOTHING`)
+	if err != nil {
+		return stats, fmt.Errorf("import: merge languages: %v", err.Error())
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO books (user_id, book_key, asin, title, authors, lang, batch_id)
+		SELECT DISTINCT ON (book_key) $1::integer, book_key, asin, title, authors, lang, $2::integer 
+		FROM import_books
+		ON CONFLICT (user_id, book_key) 
+		    DO UPDATE SET asin=EXCLUDED.asin, title=EXCLUDED.title, authors=EXCLUDED.authors, lang=EXCLUDED.lang`, userID, stats.batchID)
+	if err != nil {
+		return stats, fmt.Errorf("import: merge books: %v", err.Error())
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO words (word, stem, lang)
+		SELECT DISTINCT iw.word, iw.stem, l.id 
+		FROM import_words iw
+		JOIN languages l ON l.code = iw.lang
+		ON CONFLICT (word, stem, lang) 
+		    DO NOTHING`)
+	if err != nil {
+		return stats, fmt.Errorf("import: merge words: %v", err.Error())
+	}
+
+	err = tx.QueryRow(`
+		SELECT COUNT(DISTINCT w.id) 
+		FROM import_words iw
+		JOIN languages l ON l.code = iw.lang
+		JOIN words w ON w.word = iw.word AND w.stem = iw.stem AND w.lang = l.id
+		WHERE NOT EXISTS (
+		    SELECT 1 FROM user_words uw WHERE uw.user_id = $1 AND uw.word_id = w.id)`, userID).Scan(&stats.words)
+	if err != nil {
+		return stats, fmt.Errorf("import: count new words: %v", err.Error())
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_words (user_id, word_id, category, added_at, batch_id)
+		SELECT $1::integer, w.id, MAX(iw.category), to_timestamp(NULLIF(MIN(iw.timestamp), 0) / 1000.0), $2::integer
+		FROM import_words iw
+		JOIN languages l ON l.code = iw.lang
+		JOIN words w ON w.word = iw.word AND w.stem = iw.stem AND w.lang = l.id
+		GROUP BY w.id
+		ON CONFLICT (user_id, word_id) 
+		    DO UPDATE SET category=EXCLUDED.category, added_at=EXCLUDED.added_at`, userID, stats.batchID)
+	if err != nil {
+		return stats, fmt.Errorf("import: merge user words: %v", err.Error())
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO lookups (user_id, word_id, usage, book_key, pos, timestamp, batch_id)
+		SELECT $1::integer, w.id, il.usage, il.book_key, il.pos, il.timestamp, $2::integer
+		FROM import_lookups il
+		JOIN languages l ON l.code = il.lang
+		JOIN words w ON w.word = il.word AND w.stem = il.stem AND w.lang = l.id
+		JOIN user_words uw ON uw.user_id = $1 AND uw.word_id = w.id
+		ON CONFLICT (user_id, word_id, usage) 
+		    DO NOTHING`, userID, stats.batchID)
+	if err != nil {
+		return stats, fmt.Errorf("import: merge lookups: %v", err.Error())
+	}
+
+	lookups, err := res.RowsAffected()
+	if err != nil {
+		return stats, err
+	}
+	stats.lookups = int(lookups)
+
+	if stats.words == 0 && stats.lookups == 0 {
+		//Nothing to undo, upload isn't kept in history
+		_, err = tx.Exec("DELETE FROM import_batches WHERE id=$1", stats.batchID)
+		stats.batchID = 0
+	} else {
+		_, err = tx.Exec(`
+			UPDATE import_batches SET words_count=$2, lookups_count=$3 
+			WHERE id=$1`, stats.batchID, stats.words, stats.lookups)
+	}
+	if err != nil {
+		return stats, fmt.Errorf("import: update batch: %v", err.Error())
+	}
+
+	for _, p := range v.progress {
+		_, err = tx.Exec(`
+			INSERT INTO import_progress (user_id, profile_id, word_timestamp, lookup_timestamp) 
+			VALUES ($1, $2, $3, $4) 
+			ON CONFLICT (user_id, profile_id) 
+			    DO UPDATE SET word_timestamp=$3, lookup_timestamp=$4`, userID, p.profileID, p.wordTimestamp, p.lookupTimestamp)
+		if err != nil {
+			return stats, fmt.Errorf("import: set progress: %v", err.Error())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return stats, fmt.Errorf("postgre: tx commit: %v", err.Error())
+	}
+
+	return stats, nil
+}
+
+// copyIn streams count rows into the table with COPY FROM STDIN.
+func copyIn(tx *sql.Tx, table string, columns []string, count int, row func(i int) []interface{}) error {
+	stmt, err := tx.Prepare(pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		_, err = stmt.Exec(row(i)...)
+		if err != nil {
+			_ = stmt.Close()
+			return err
+		}
+	}
+
+	_, err = stmt.Exec()
+	if err != nil {
+		_ = stmt.Close()
+		return err
+	}
+
+	return stmt.Close()
+}
+
+func (repo *repository) addDownloadJob(j downloadJob) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO jobs (user_id, kind, file_id, size) 
+		VALUES ($1, $2, $3, $4)`, j.userId, downloadJobKind, j.fileId, j.size)
+	if err != nil {
+		return fmt.Errorf("add download job: %v", err.Error())
+	}
+	return nil
+}
+
+func (repo *repository) addMigrationJob(j migrationJob) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO jobs (user_id, kind, path, profiles, confirmed) 
+		VALUES ($1, $2, $3, $4, $5)`, j.userId, importJobKind, j.documentPath, pq.Array(j.profiles), j.confirmed)
+	if err != nil {
+		return fmt.Errorf("add migration job: %v", err.Error())
+	}
+	return nil
+}
+
+// claimDownloadJob marks the oldest queued download job as running,
+// locked jobs are skipped, so concurrent workers never claim the same job.
+func (repo *repository) claimDownloadJob() (*downloadJob, error) {
+	j := downloadJob{}
+	err := repo.db.QueryRow(`
+		UPDATE jobs SET status=$3, attempts=attempts+1, updated_at=now() 
+		WHERE id = (
+		    SELECT id 
+		    FROM jobs 
+		    WHERE kind=$1 AND status=$2 
+		    ORDER BY id 
+		    LIMIT 1 
+		    FOR UPDATE SKIP LOCKED) 
+		RETURNING id, user_id, file_id, size`, downloadJobKind, jobQueued, jobDownloading).Scan(&j.id, &j.userId, &j.fileId, &j.size)
+	if err == sql.ErrNoRows {
+		return nil, errNoJobs
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim download job: %v", err.Error())
+	}
+	return &j, nil
+}
+
+// claimMigrationJob marks the oldest queued migration job as running.
+func (repo *repository) claimMigrationJob() (*migrationJob, error) {
+	j := migrationJob{}
+	err := repo.db.QueryRow(`
+		UPDATE jobs SET status=$3, attempts=attempts+1, updated_at=now() 
+		WHERE id = (
+		    SELECT id 
+		    FROM jobs 
+		    WHERE kind=$1 AND status=$2 
+		    ORDER BY id 
+		    LIMIT 1 
+		    FOR UPDATE SKIP LOCKED) 
+		RETURNING id, user_id, path, profiles, confirmed`, importJobKind, jobQueued, jobImporting).Scan(
+		&j.id, &j.userId, &j.documentPath, pq.Array(&j.profiles), &j.confirmed)
+	if err == sql.ErrNoRows {
+		return nil, errNoJobs
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim migration job: %v", err.Error())
+	}
+	return &j, nil
+}
+
+func (repo *repository) finishJob(id int, status jobStatus, errMsg string) error {
+	_, err := repo.db.Exec(`
+		UPDATE jobs SET status=$2, error=NULLIF($3, ''), updated_at=now() 
+		WHERE id=$1`, id, status, errMsg)
+	if err != nil {
+		return fmt.Errorf("finish job: %v", err.Error())
+	}
+	return nil
+}
+
+func (repo *repository) requeueJob(id int) error {
+	_, err := repo.db.Exec("UPDATE jobs SET status=$2, updated_at=now() WHERE id=$1", id, jobQueued)
+	if err != nil {
+		return fmt.Errorf("requeue job: %v", err.Error())
+	}
+	return nil
+}
+
+// getInterruptedJobs returns the jobs left running by stopped process.
+func (repo *repository) getInterruptedJobs() ([]interruptedJob, error) {
+	rows, err := repo.db.Query(`
+		SELECT id, user_id, kind, COALESCE(path, ''), confirmed, attempts 
+		FROM jobs 
+		WHERE status IN ($1, $2) 
+		ORDER BY id`, jobDownloading, jobImporting)
+	if err != nil {
+		return nil, fmt.Errorf("get interrupted jobs: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	jobs := make([]interruptedJob, 0)
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		j := interruptedJob{}
+		err = rows.Scan(&j.id, &j.userId, &j.kind, &j.path, &j.confirmed, &j.attempts)
+		if err != nil {
+			return nil, fmt.Errorf("get interrupted jobs: %v", err.Error())
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// getCachedTranslations returns the machine translation of every word
+// that has been translated before.
+func (repo *repository) getCachedTranslations(wordIDs []int, langID int) (map[int]string, error) {
+	rows, err := repo.db.Query(`
+		SELECT DISTINCT ON (word_id) word_id, translation 
+		FROM accepted_translations 
+		WHERE word_id = ANY($1) AND lang=$2 
+		ORDER BY word_id, source=$3 DESC, id`, pq.Array(wordIDs), langID, backendTranslation)
+	if err != nil {
+		return nil, fmt.Errorf("get cached translations: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	translations := make(map[int]string)
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var wordID int
+		var t string
+		err = rows.Scan(&wordID, &t)
+		if err != nil {
+			return nil, fmt.Errorf("get cached translations: %v", err.Error())
+		}
+		translations[wordID] = t
+	}
+
+	return translations, nil
+}
+
+// getAcceptedTranslations returns translations of the word to the language,
+// translations from the backend go first.
+func (repo *repository) getAcceptedTranslations(wordID, langID int) ([]string, error) {
+	rows, err := repo.db.Query(`
+		SELECT translation 
+		FROM accepted_translations 
+		WHERE word_id=$1 AND lang=$2 
+		ORDER BY source=$3 DESC, id`, wordID, langID, backendTranslation)
+	if err != nil {
+		return nil, fmt.Errorf("get translations: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	translations := make([]string, 0)
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var t string
+		err = rows.Scan(&t)
+		if err != nil {
+			return nil, fmt.Errorf("get translations: %v", err.Error())
+		}
+		translations = append(translations, t)
+	}
+
+	return translations, nil
+}
+
+func (repo *repository) addAcceptedTranslations(wordID, langID int, translations []string, source translationSource) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO accepted_translations (word_id, lang, translation, source) 
+		SELECT $1, $2, t, $4 
+		FROM unnest($3::text[]) AS t 
+		ON CONFLICT (word_id, lang, translation) DO NOTHING`, wordID, langID, pq.Array(translations), source)
+	if err != nil {
+		return fmt.Errorf("add translations: %v", err.Error())
+	}
+	return nil
+}
+
+// addDispute disputes the last answer of the user, only incorrect
+// translations without hints can be disputed. errNoDispute is returned otherwise.
+func (repo *repository) addDispute(userID int) (*dispute, error) {
+	d := dispute{userID: userID}
+	var grade answerGrade
+	var direction quizDirection
+	var kind questionKind
+	var hints int
+	err := repo.db.QueryRow(`
+		SELECT a.id, a.word_id, w.word, a.user_lang, COALESCE(a.guess, ''), a.grade, a.direction, a.kind, a.hints 
+		FROM answers a 
+		JOIN words w ON w.id = a.word_id 
+		WHERE a.user_id=$1 
+		ORDER BY a.id DESC 
+		LIMIT 1`, userID).Scan(&d.answerID, &d.wordID, &d.word, &d.langID, &d.guess, &grade, &direction, &kind, &hints)
+	if err == sql.ErrNoRows {
+		return nil, errNoDispute
+	}
+	if err != nil {
+		return nil, fmt.Errorf("add dispute: %v", err.Error())
+	}
+
+	//Only typed translations are disputed, chosen options and flashcards aren't translations
+	//and answers marked down for hints aren't wrong translations
+	if grade != gradeIncorrect || direction != forwardDirection || kind != translationQuestion || hints > 0 ||
+		strings.TrimSpace(d.guess) == "" {
+		return nil, errNoDispute
+	}
+
+	err = repo.db.QueryRow(`
+		INSERT INTO disputes (answer_id) 
+		VALUES ($1) 
+		ON CONFLICT (answer_id) 
+		    DO UPDATE SET answer_id=$1 
+		RETURNING id, status`, d.answerID).Scan(&d.id, &d.status)
+	if err != nil {
+		return nil, fmt.Errorf("add dispute: %v", err.Error())
+	}
+
+	return &d, nil
+}
+
+func (repo *repository) getPendingDisputes(limit int) ([]dispute, error) {
+	rows, err := repo.db.Query(`
+		SELECT d.id, d.status, a.id, a.user_id, a.word_id, w.word, a.user_lang, COALESCE(a.guess, '') 
+		FROM disputes d 
+		JOIN answers a ON a.id = d.answer_id 
+		JOIN words w ON w.id = a.word_id 
+		WHERE d.status=$1 
+		ORDER BY d.id 
+		LIMIT $2`, disputePending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get disputes: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	disputes := make([]dispute, 0)
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		d := dispute{}
+		err = rows.Scan(&d.id, &d.status, &d.answerID, &d.userID, &d.wordID, &d.word, &d.langID, &d.guess)
+		if err != nil {
+			return nil, fmt.Errorf("get disputes: %v", err.Error())
+		}
+		disputes = append(disputes, d)
+	}
+
+	return disputes, nil
+}
+
+// resolveDispute records the review, the accepted guess becomes
+// a translation of the word and the answer is counted as correct.
+func (repo *repository) resolveDispute(id, reviewerID int, status disputeStatus) (*dispute, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("postgres tx begin: %v", err.Error())
+	}
+
+	d := dispute{id: id}
+	err = tx.QueryRow(`
+		UPDATE disputes 
+		SET status=$3, reviewer_id=$2, reviewed_at=now() 
+		WHERE id=$1 AND status=$4 
+		RETURNING status, answer_id`, id, reviewerID, status, disputePending).Scan(&d.status, &d.answerID)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return nil, errNotReviewed
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("resolve dispute: %v", err.Error())
+	}
+
+	var direction quizDirection
+	err = tx.QueryRow(`
+		SELECT a.user_id, a.word_id, w.word, a.user_lang, COALESCE(a.guess, ''), a.direction 
+		FROM answers a 
+		JOIN words w ON w.id = a.word_id 
+		WHERE a.id=$1`, d.answerID).Scan(&d.userID, &d.wordID, &d.word, &d.langID, &d.guess, &direction)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("resolve dispute: %v", err.Error())
+	}
+
+	if status == disputeAccepted {
+		_, err = tx.Exec(`
+			INSERT INTO accepted_translations (word_id, lang, translation, source) 
+			VALUES ($1, $2, $3, $4) 
+			ON CONFLICT (word_id, lang, translation) DO NOTHING`, d.wordID, d.langID, strings.TrimSpace(d.guess), disputedTranslation)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("resolve dispute: translation: %v", err.Error())
+		}
+
+		_, err = tx.Exec("UPDATE answers SET correct=true, grade=$2 WHERE id=$1", d.answerID, gradeCorrect)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("resolve dispute: answer: %v", err.Error())
+		}
+
+		_, err = tx.Exec(`
+			UPDATE user_words 
+			SET correct_answers = correct_answers + 1, 
+			    incorrect_answers = GREATEST(incorrect_answers - 1, 0) 
+			WHERE user_id=$1 AND word_id=$2`, d.userID, d.wordID)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("resolve dispute: counters: %v", err.Error())
+		}
+
+		err = rescheduleWord(tx, d.userID, d.wordID, direction)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("resolve dispute: %v", err.Error())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("postgres tx commit: %v", err.Error())
+	}
+
+	return &d, nil
+}
+
+// rescheduleWord replays the answers of the word after the grade of one is changed,
+// the word is due the interval after the last answer.
+func rescheduleWord(tx *sql.Tx, userID, wordID int, direction quizDirection) error {
+	var answeredAt time.Time
+	err := tx.QueryRow(`
+		SELECT COALESCE(last_answered_at, now()) 
+		FROM word_schedules 
+		WHERE user_id=$1 AND word_id=$2 AND direction=$3 
+		FOR UPDATE`, userID, wordID, direction).Scan(&answeredAt)
+	if err != nil {
+		return fmt.Errorf("reschedule: %v", err.Error())
+	}
+
+	rows, err := tx.Query(`
+		SELECT correct, grade, hints, COALESCE(rating, ''), kind, COALESCE(guess, '') 
+		FROM answers 
+		WHERE user_id=$1 AND word_id=$2 AND direction=$3 
+		ORDER BY id`, userID, wordID, direction)
+	if err != nil {
+		return fmt.Errorf("reschedule: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	answers := make([]answerRecord, 0)
+	correct := 0
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return err
+		}
+
+		var a answerRecord
+		err = rows.Scan(&a.correct, &a.grade, &a.hints, &a.rating, &a.kind, &a.guess)
+		if err != nil {
+			return fmt.Errorf("reschedule: %v", err.Error())
+		}
+		answers = append(answers, a)
+
+		if a.correct {
+			correct++
+		}
+	}
+
+	sched, streak := replaySchedule(answers, answeredAt)
+
+	_, err = tx.Exec(`
+		UPDATE word_schedules ws 
+		SET ease=$4, interval_days=$5, repetitions=$6, due_at=$7, 
+		    correct_answers=$8, incorrect_answers=$9, streak=$10, 
+		    retired_at = CASE WHEN u.mastery_threshold > 0 AND $10 >= u.mastery_threshold 
+		                      THEN COALESCE(ws.retired_at, now()) END 
+		FROM users u 
+		WHERE u.id = ws.user_id AND ws.user_id=$1 AND ws.word_id=$2 AND ws.direction=$3`,
+		userID, wordID, direction, sched.ease, sched.interval, sched.repetitions, sched.dueAt,
+		correct, len(answers)-correct, streak)
+	if err != nil {
+		return fmt.Errorf("reschedule: %v", err.Error())
+	}
+
+	return nil
+}
+
+func (repo *repository) getReviewers() ([]int, error) {
+	rows, err := repo.db.Query("SELECT id FROM users WHERE is_reviewer ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("get reviewers: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	reviewers := make([]int, 0)
+
+	for rows.Next() {
+
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("get reviewers: %v", err.Error())
+		}
+		reviewers = append(reviewers, id)
+	}
+
+	return reviewers, nil
+}
+
+// startSession starts the session, errSessionActive is returned if the user has one.
+func (repo *repository) startSession(userID, length int) (*quizSession, error) {
+	s := quizSession{length: length}
+	err := repo.db.QueryRow(`
+		INSERT INTO quiz_sessions (user_id, length) 
+		VALUES ($1, $2) 
+		ON CONFLICT DO NOTHING 
+		RETURNING id, started_at`, userID, length).Scan(&s.id, &s.startedAt)
+	if err == sql.ErrNoRows {
+		return nil, errSessionActive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("start session: %v", err.Error())
+	}
+	return &s, nil
+}
+
+func (repo *repository) getActiveSession(userID int) (*quizSession, error) {
+	s := quizSession{}
+	err := repo.db.QueryRow(`
+		SELECT s.id, s.length, s.started_at, COUNT(a.id), COUNT(a.id) FILTER (WHERE a.correct) 
+		FROM quiz_sessions s 
+		LEFT JOIN answers a ON a.session_id = s.id 
+		WHERE s.user_id=$1 AND s.status=$2 
+		GROUP BY s.id`, userID, sessionActive).Scan(&s.id, &s.length, &s.startedAt, &s.asked, &s.correct)
+	if err == sql.ErrNoRows {
+		return nil, errNoSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %v", err.Error())
+	}
+	return &s, nil
+}
+
+// finishSession ends the active session and summarizes it
+// with the previous session that has answers.
+func (repo *repository) finishSession(userID int, status sessionStatus) (*sessionSummary, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("postgres tx begin: %v", err.Error())
+	}
+
+	summary := sessionSummary{}
+	s := &summary.session
+	err = tx.QueryRow(`
+		UPDATE quiz_sessions 
+		SET status=$2, finished_at=now() 
+		WHERE user_id=$1 AND status=$3 
+		RETURNING id, length, started_at, finished_at`, userID, status, sessionActive).Scan(&s.id, &s.length, &s.startedAt, &s.finishedAt)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return nil, errNoSession
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("finish session: %v", err.Error())
+	}
+
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE correct) 
+		FROM answers 
+		WHERE session_id=$1`, s.id).Scan(&s.asked, &s.correct)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("finish session: answers: %v", err.Error())
+	}
+
+	rows, err := tx.Query(`
+		SELECT w.word 
+		FROM answers a 
+		JOIN words w ON w.id = a.word_id 
+		WHERE a.session_id=$1 AND NOT a.correct 
+		GROUP BY w.word 
+		ORDER BY MIN(a.id)`, s.id)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("finish session: missed words: %v", err.Error())
+	}
+
+	summary.missed = make([]string, 0)
+	for rows.Next() {
+		var w string
+		err = rows.Scan(&w)
+		if err != nil {
+			_ = rows.Close()
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("finish session: missed words: %v", err.Error())
+		}
+		summary.missed = append(summary.missed, w)
+	}
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("finish session: missed words: %v", err.Error())
+	}
+
+	prev := quizSession{}
+	err = tx.QueryRow(`
+		SELECT s.id, s.length, s.started_at, s.finished_at, COUNT(a.id), COUNT(a.id) FILTER (WHERE a.correct) 
+		FROM quiz_sessions s 
+		JOIN answers a ON a.session_id = s.id 
+		WHERE s.user_id=$1 AND s.id < $2 AND s.status <> $3 
+		GROUP BY s.id 
+		ORDER BY s.id DESC 
+		LIMIT 1`, userID, s.id, sessionActive).Scan(&prev.id, &prev.length, &prev.startedAt, &prev.finishedAt, &prev.asked, &prev.correct)
+	if err != nil && err != sql.ErrNoRows {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("finish session: previous: %v", err.Error())
+	}
+	if err == nil {
+		summary.previous = &prev
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("postgres tx commit: %v", err.Error())
+	}
+
+	return &summary, nil
+}
@@ -1,6 +1,8 @@
 package kindle_quiz_bot
 
 import (
+	"database/sql"
+	"reflect"
 	"testing"
 )
 
@@ -34,12 +36,12 @@ func TestGetLang(t *testing.T) {
 }
 
 func TestGetRandomWord(t *testing.T) {
-	testWord, err := repo.getRandomWord(testUserId)
+	testWord, err := repo.getNextWord(testUserId)
 	if err != nil {
 		t.Fatalf("Couldn't get random word: %v", err)
 	}
 
-	_, err = repo.getRandomWord(-1)
+	_, err = repo.getNextWord(-1)
 	if err != errNoWordsFound {
 		t.Fatalf("Words shouldn't be found")
 	}
@@ -50,7 +52,7 @@ func TestGetRandomWord(t *testing.T) {
 }
 
 func TestSetLastWord(t *testing.T) {
-	word, err := repo.getRandomWord(testUserId)
+	word, err := repo.getNextWord(testUserId)
 	if err != nil {
 		t.Fatalf("Couldn't get random word: %v", err)
 	}
@@ -62,7 +64,7 @@ func TestSetLastWord(t *testing.T) {
 }
 
 func TestGetLastWord(t *testing.T) {
-	word, err := repo.getRandomWord(testUserId)
+	word, err := repo.getNextWord(testUserId)
 	if err != nil {
 		t.Fatalf("Couldn't get random word: %v", err)
 	}
@@ -84,7 +86,7 @@ func TestGetLastWord(t *testing.T) {
 }
 
 func TestGetWord(t *testing.T) {
-	word, err := repo.getRandomWord(testUserId)
+	word, err := repo.getNextWord(testUserId)
 	if err != nil {
 		t.Fatalf("Couldn't get random word: %v", err)
 	}
@@ -139,26 +141,201 @@ func TestGetLanguageWithCode(t *testing.T) {
 }
 
 func TestPersistAnswer(t *testing.T) {
-	word, err := repo.getRandomWord(testUserId)
+	word, err := repo.getNextWord(testUserId)
 	if err != nil {
 		t.Fatalf("Couldn't get random word: %v", err)
 	}
 
-	params := guessParams{*word, "!@#$%", testUserId}
-	result := guessResult{params, "foobar"}
+	params := guessParams{*word, "!@#$%", testUserId, forwardDirection, translationQuestion, "", 0, noRating}
+	result := guessResult{params, "foobar", nil}
 
-	err = repo.persistAnswer(result)
+	_, err = repo.persistAnswer(result)
 	if err != nil {
 		t.Fatalf("Couldn't persist answer: %v", err)
 	}
+
+	params.guess = "foobra"
+	_, err = repo.persistAnswer(guessResult{params, "foobar", nil})
+	if err != nil {
+		t.Fatalf("Couldn't persist answer: %v", err)
+	}
+
+	var correct bool
+	var grade answerGrade
+	err = repo.db.QueryRow(`
+		SELECT correct, grade 
+		FROM answers 
+		WHERE user_id=$1 
+		ORDER BY id DESC 
+		LIMIT 1`, testUserId).Scan(&correct, &grade)
+	if err != nil {
+		t.Fatalf("Couldn't read answer: %v", err)
+	}
+
+	if correct || grade != gradeAlmostCorrect {
+		t.Fatalf("Answer with a typo should be saved as almost correct: %v, %v", correct, grade)
+	}
+}
+
+// addTestWord imports the word like an upload does and returns its id.
+func addTestWord(t *testing.T, userID int, w vocabWord) int {
+	_, err := repo.importVocabulary(userID, vocabulary{words: []vocabWord{w}})
+	if err != nil {
+		t.Fatalf("Couldn't import word: %v", err)
+	}
+
+	var wordID int
+	err = repo.db.QueryRow(`
+		SELECT w.id 
+		FROM words w
+		JOIN languages l ON l.id = w.lang
+		WHERE w.word=$1 AND w.stem=$2 AND l.code=$3`, w.word, w.stem, normalizeLangCode(w.lc)).Scan(&wordID)
+	if err != nil {
+		t.Fatalf("Couldn't get imported word: %v", err)
+	}
+
+	return wordID
+}
+
+// newTestUser creates a user isolated from other tests with the given words,
+// ids follow the words and the returned func removes everything the user owns.
+func newTestUser(t *testing.T, userID int, words ...vocabWord) ([]int, func()) {
+	_, err := repo.createUser(userID)
+	if err != nil {
+		t.Fatalf("Couldn't create user: %v", err)
+	}
+
+	ids := make([]int, 0, len(words))
+	for _, w := range words {
+		ids = append(ids, addTestWord(t, userID, w))
+	}
+
+	return ids, func() {
+		deleteTestUser(t, userID)
+	}
+}
+
+// deleteTestUser removes the user with their answers, words and imports,
+// the words themselves are shared and stay.
+func deleteTestUser(t *testing.T, userID int) {
+	queries := []string{
+		"UPDATE disputes SET reviewer_id=NULL WHERE reviewer_id=$1",
+		"DELETE FROM answers WHERE user_id=$1",
+		"DELETE FROM questions WHERE user_id=$1",
+		"DELETE FROM quiz_sessions WHERE user_id=$1",
+		"DELETE FROM user_words WHERE user_id=$1",
+		"DELETE FROM books WHERE user_id=$1",
+		"DELETE FROM import_progress WHERE user_id=$1",
+		"DELETE FROM user_profiles WHERE user_id=$1",
+		"DELETE FROM pending_uploads WHERE user_id=$1",
+		"DELETE FROM jobs WHERE user_id=$1",
+		"DELETE FROM import_batches WHERE user_id=$1",
+		"DELETE FROM users WHERE id=$1",
+	}
+
+	for _, q := range queries {
+		_, err := repo.db.Exec(q, userID)
+		if err != nil {
+			t.Fatalf("Couldn't delete test user: %v", err)
+		}
+	}
+}
+
+func TestImportVocabulary(t *testing.T) {
+	w := vocabWord{word: "прочитал", stem: "прочитать", lc: "ru", timestamp: 1}
+	l := vocabLookup{word: w, usage: "Я прочитал эту книгу", bookKey: "test_book", timestamp: 1}
+	v := vocabulary{
+		words:    []vocabWord{w},
+		lookups:  []vocabLookup{l, l},
+		books:    []book{{key: "test_book", title: "Test book", authors: "Tester", lang: "ru"}},
+		progress: []importProgress{{profileID: "test_profile", wordTimestamp: 1, lookupTimestamp: 1}},
+	}
+
+	stats, err := repo.importVocabulary(testUserId, v)
+	if err != nil {
+		t.Fatalf("Couldn't import vocabulary: %v", err)
+	}
+
+	if stats.words != 1 || stats.lookups != 1 {
+		t.Fatalf("Invalid import stats: %d words, %d lookups", stats.words, stats.lookups)
+	}
+
+	//Same vocabulary must be ignored
+	stats, err = repo.importVocabulary(testUserId, v)
+	if err != nil {
+		t.Fatalf("Couldn't import vocabulary twice: %v", err)
+	}
+
+	if stats.words != 0 || stats.lookups != 0 {
+		t.Fatalf("Vocabulary imported twice: %d words, %d lookups", stats.words, stats.lookups)
+	}
+
+	progress, err := repo.getImportProgress(testUserId, "test_profile")
+	if err != nil {
+		t.Fatalf("Couldn't get import progress: %v", err)
+	}
+
+	if progress.wordTimestamp != 1 || progress.lookupTimestamp != 1 {
+		t.Fatalf("Import progress isn't saved")
+	}
+}
+
+func TestImportSingleWord(t *testing.T) {
+	w := vocabWord{word: "проверил", stem: "проверить", lc: "ru", timestamp: 3}
+
+	stats, err := repo.importVocabulary(testUserId, vocabulary{words: []vocabWord{w}})
+	if err != nil {
+		t.Fatalf("Couldn't import word: %v", err)
+	}
+
+	if stats.words != 1 {
+		t.Fatalf("Invalid import stats: %d words", stats.words)
+	}
+
+	ru, err := repo.getLanguageWithCode("ru")
+	if err != nil {
+		t.Fatalf("Couldn't get language with code: %v", err)
+	}
+
+	var wordID, langID, userWords int
+	err = repo.db.QueryRow(`
+		SELECT w.id, w.lang 
+		FROM words w
+		WHERE w.word=$1 AND w.stem=$2`, w.word, w.stem).Scan(&wordID, &langID)
+	if err != nil {
+		t.Fatalf("Couldn't get imported word: %v", err)
+	}
+
+	if langID != ru.id {
+		t.Fatalf("Word stored with language %d instead of %d", langID, ru.id)
+	}
+
+	err = repo.db.QueryRow(`
+		SELECT count(*) 
+		FROM user_words 
+		WHERE user_id=$1 AND word_id=$2`, testUserId, wordID).Scan(&userWords)
+	if err != nil {
+		t.Fatalf("Couldn't get user words: %v", err)
+	}
+
+	if userWords != 1 {
+		t.Fatalf("Word should be added to the user once, got %d rows", userWords)
+	}
 }
 
-func TestAddWordForUser(t *testing.T) {
-	word := word{word: "проверил", stem: "проверить"}
+func TestToggleShowContext(t *testing.T) {
+	showContext, err := repo.toggleShowContext(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't toggle context: %v", err)
+	}
 
-	err := repo.addWordForUser(testUserId, word, "ru")
+	user, err := repo.getUser(testUserId)
 	if err != nil {
-		t.Fatalf("Couldn't add word for user: %v", err)
+		t.Fatalf("Couldn't get user: %v", err)
+	}
+
+	if user.showContext != showContext {
+		t.Fatalf("Invalid show context value")
 	}
 }
 
@@ -246,3 +423,883 @@ func TestUpdateUserLang(t *testing.T) {
 		t.Fatalf("Invalid user state")
 	}
 }
+
+func TestGetBooks(t *testing.T) {
+	books, err := repo.getBooks(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get books: %v", err)
+	}
+
+	if len(books) == 0 {
+		t.Fatalf("Books weren't migrated")
+	}
+
+	wordsCount := 0
+	for _, b := range books {
+		wordsCount += b.wordsCount
+	}
+
+	if wordsCount == 0 {
+		t.Fatalf("Words aren't linked to books")
+	}
+}
+
+func TestSetQuizBook(t *testing.T) {
+	books, err := repo.getBooks(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get books: %v", err)
+	}
+
+	var selected *book
+	for i := range books {
+		if books[i].wordsCount > 0 {
+			selected = &books[i]
+			break
+		}
+	}
+
+	if selected == nil {
+		t.Fatalf("No books with words")
+	}
+
+	err = repo.setQuizBook(testUserId, &selected.id)
+	if err != nil {
+		t.Fatalf("Couldn't set quiz book: %v", err)
+	}
+
+	user, err := repo.getUser(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get user: %v", err)
+	}
+
+	if !user.quizBook.Valid || int(user.quizBook.Int64) != selected.id {
+		t.Fatalf("Quiz book isn't set")
+	}
+
+	_, err = repo.getNextWord(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get random word from book: %v", err)
+	}
+
+	err = repo.setQuizBook(testUserId, nil)
+	if err != nil {
+		t.Fatalf("Couldn't reset quiz book: %v", err)
+	}
+}
+
+func TestSkipMasteredWords(t *testing.T) {
+	const masteredUserId = -2
+
+	w := vocabWord{word: "выучил", stem: "выучить", lc: "ru", category: kindleCategoryMastered, timestamp: 1525719074468}
+	_, cleanup := newTestUser(t, masteredUserId, w)
+	defer cleanup()
+
+	_, err := repo.getNextWord(masteredUserId)
+	if err != errNoWordsFound {
+		t.Fatalf("Mastered word shouldn't be asked")
+	}
+
+	includeMastered, err := repo.toggleIncludeMastered(masteredUserId)
+	if err != nil {
+		t.Fatalf("Couldn't toggle mastered words: %v", err)
+	}
+
+	if !includeMastered {
+		t.Fatalf("Mastered words should be included")
+	}
+
+	_, err = repo.getNextWord(masteredUserId)
+	if err != nil {
+		t.Fatalf("Mastered word should be asked: %v", err)
+	}
+}
+
+func TestImportWordLanguage(t *testing.T) {
+	w := vocabWord{word: "Bank", stem: "Bank", lc: "DE", timestamp: 2}
+	unknown := vocabWord{word: "banco", stem: "banco", lc: "es", timestamp: 2}
+	v := vocabulary{words: []vocabWord{w, unknown}}
+
+	_, err := repo.importVocabulary(testUserId, v)
+	if err != nil {
+		t.Fatalf("Couldn't import vocabulary: %v", err)
+	}
+
+	de, err := repo.getLanguageWithCode("de")
+	if err != nil {
+		t.Fatalf("Couldn't get language with code: %v", err)
+	}
+
+	var langId int
+	err = repo.db.QueryRow(`
+		SELECT w.lang 
+		FROM user_words uw
+		JOIN words w ON w.id = uw.word_id
+		WHERE uw.user_id=$1 AND w.word=$2 AND w.stem=$3`, testUserId, w.word, w.stem).Scan(&langId)
+	if err != nil {
+		t.Fatalf("Couldn't get word: %v", err)
+	}
+
+	if langId != de.id {
+		t.Fatalf("Word stored with user language instead of its own")
+	}
+
+	es, err := repo.getLanguageWithCode("es")
+	if err != nil {
+		t.Fatalf("Unknown language wasn't added: %v", err)
+	}
+
+	if es.code != "es" {
+		t.Fatalf("Language code incorrect")
+	}
+}
+
+func TestProfileChoices(t *testing.T) {
+	choices := map[string]bool{"first": true, "second": false}
+
+	err := repo.setProfileChoices(testUserId, choices)
+	if err != nil {
+		t.Fatalf("Couldn't set profile choices: %v", err)
+	}
+
+	stored, err := repo.getProfileChoices(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get profile choices: %v", err)
+	}
+
+	if !stored["first"] || stored["second"] {
+		t.Fatalf("Profile choices aren't same")
+	}
+
+	err = repo.deleteProfileChoices(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't delete profile choices: %v", err)
+	}
+
+	stored, err = repo.getProfileChoices(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get profile choices: %v", err)
+	}
+
+	if len(stored) != 0 {
+		t.Fatalf("Profile choices weren't deleted")
+	}
+}
+
+func TestPendingUpload(t *testing.T) {
+	err := repo.setPendingUpload(testUserId, pendingUpload{path: "test_vocab.db"})
+	if err != nil {
+		t.Fatalf("Couldn't set pending upload: %v", err)
+	}
+
+	upload, err := repo.getPendingUpload(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get pending upload: %v", err)
+	}
+
+	if upload.path != "test_vocab.db" || upload.profiles != nil {
+		t.Fatalf("Pending upload isn't same")
+	}
+
+	err = repo.setPendingUpload(testUserId, pendingUpload{path: "test_vocab.db", profiles: []string{"", "first"}})
+	if err != nil {
+		t.Fatalf("Couldn't update pending upload: %v", err)
+	}
+
+	upload, err = repo.getPendingUpload(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get pending upload: %v", err)
+	}
+
+	if len(upload.profiles) != 2 || upload.profiles[1] != "first" {
+		t.Fatalf("Pending upload profiles aren't same")
+	}
+
+	err = repo.deletePendingUpload(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't delete pending upload: %v", err)
+	}
+
+	_, err = repo.getPendingUpload(testUserId)
+	if err != sql.ErrNoRows {
+		t.Fatalf("Pending upload wasn't deleted")
+	}
+
+	err = repo.setPendingUpload(testUserId, pendingUpload{path: "expired_vocab.db"})
+	if err != nil {
+		t.Fatalf("Couldn't set pending upload: %v", err)
+	}
+
+	paths, err := repo.deleteExpiredPendingUploads(pendingUploadTTL)
+	if err != nil || len(paths) != 0 {
+		t.Fatalf("Fresh upload shouldn't expire: %v, %v", paths, err)
+	}
+
+	_, err = repo.db.Exec("UPDATE pending_uploads SET created_at = now() - interval '2 days' WHERE user_id=$1", testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't age pending upload: %v", err)
+	}
+
+	paths, err = repo.deleteExpiredPendingUploads(pendingUploadTTL)
+	if err != nil || !reflect.DeepEqual(paths, []string{"expired_vocab.db"}) {
+		t.Fatalf("Old upload should expire: %v, %v", paths, err)
+	}
+}
+
+func TestGetUserWordKeys(t *testing.T) {
+	w := vocabWord{word: "schon", stem: "schon", lc: "de", timestamp: 3}
+
+	_, err := repo.importVocabulary(testUserId, vocabulary{words: []vocabWord{w}})
+	if err != nil {
+		t.Fatalf("Couldn't import vocabulary: %v", err)
+	}
+
+	keys, err := repo.getUserWordKeys(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get user word keys: %v", err)
+	}
+
+	if !keys[wordKey(w.word, w.stem, w.lc)] {
+		t.Fatalf("Imported word isn't known")
+	}
+}
+
+func TestUndoImportBatch(t *testing.T) {
+	const undoUserId = -3
+
+	_, cleanup := newTestUser(t, undoUserId)
+	defer cleanup()
+
+	existing := vocabWord{word: "Ufer", stem: "Ufer", lc: "de", timestamp: 1}
+	_, err := repo.importVocabulary(undoUserId, vocabulary{fileHash: "first", words: []vocabWord{existing}})
+	if err != nil {
+		t.Fatalf("Couldn't import vocabulary: %v", err)
+	}
+
+	existingWord, err := repo.getNextWord(undoUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get random word: %v", err)
+	}
+
+	_, err = repo.persistAnswer(guessResult{guessParams{*existingWord, "shore", undoUserId, forwardDirection, translationQuestion, "", 0, noRating}, "shore", nil})
+	if err != nil {
+		t.Fatalf("Couldn't persist answer: %v", err)
+	}
+
+	wrong := vocabWord{word: "Bank", stem: "Bank", lc: "de", timestamp: 2}
+	v := vocabulary{
+		fileHash: "second",
+		words:    []vocabWord{existing, wrong},
+		lookups:  []vocabLookup{{word: wrong, usage: "Er sitzt auf der Bank", bookKey: "wrong_book", timestamp: 2}},
+		books:    []book{{key: "wrong_book", title: "Wrong book"}},
+	}
+
+	stats, err := repo.importVocabulary(undoUserId, v)
+	if err != nil {
+		t.Fatalf("Couldn't import vocabulary: %v", err)
+	}
+
+	if stats.batchID == 0 || stats.words != 1 {
+		t.Fatalf("Invalid import stats: batch %d, %d words", stats.batchID, stats.words)
+	}
+
+	batches, err := repo.getImportBatches(undoUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get import batches: %v", err)
+	}
+
+	if len(batches) != 2 || batches[1].fileHash != "second" {
+		t.Fatalf("Import batches aren't recorded")
+	}
+
+	err = repo.undoImportBatch(undoUserId, stats.batchID)
+	if err != nil {
+		t.Fatalf("Couldn't undo import: %v", err)
+	}
+
+	err = repo.undoImportBatch(undoUserId, stats.batchID)
+	if err != errBatchNotFound {
+		t.Fatalf("Batch should be removed")
+	}
+
+	keys, err := repo.getUserWordKeys(undoUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get user word keys: %v", err)
+	}
+
+	if len(keys) != 1 || !keys[wordKey(existing.word, existing.stem, existing.lc)] {
+		t.Fatalf("Only words introduced by the batch should be removed")
+	}
+
+	var answers int
+	err = repo.db.QueryRow("SELECT COUNT(*) FROM answers WHERE user_id=$1", undoUserId).Scan(&answers)
+	if err != nil {
+		t.Fatalf("Couldn't count answers: %v", err)
+	}
+
+	if answers != 1 {
+		t.Fatalf("Answers for existing words should be kept")
+	}
+
+	books, err := repo.getBooks(undoUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get books: %v", err)
+	}
+
+	if len(books) != 0 {
+		t.Fatalf("Books introduced by the batch should be removed")
+	}
+}
+
+func TestJobsQueue(t *testing.T) {
+	err := repo.addDownloadJob(downloadJob{userId: testUserId, fileId: "BQACAgIAAxkBAAIB"})
+	if err != nil {
+		t.Fatalf("Couldn't add download job: %v", err)
+	}
+
+	job, err := repo.claimDownloadJob()
+	if err != nil {
+		t.Fatalf("Couldn't claim download job: %v", err)
+	}
+
+	if job.userId != testUserId || job.fileId != "BQACAgIAAxkBAAIB" {
+		t.Fatalf("Invalid job claimed: %+v", job)
+	}
+
+	_, err = repo.claimDownloadJob()
+	if err != errNoJobs {
+		t.Fatalf("Running job shouldn't be claimed twice: %v", err)
+	}
+
+	err = repo.addMigrationJob(migrationJob{downloadJob: downloadJob{userId: testUserId}, documentPath: "/tmp/vocab.db", profiles: []string{""}, confirmed: true})
+	if err != nil {
+		t.Fatalf("Couldn't add migration job: %v", err)
+	}
+
+	migration, err := repo.claimMigrationJob()
+	if err != nil {
+		t.Fatalf("Couldn't claim migration job: %v", err)
+	}
+
+	if !migration.confirmed || len(migration.profiles) != 1 {
+		t.Fatalf("Invalid migration job claimed: %+v", migration)
+	}
+
+	err = repo.finishJob(job.id, jobDone, "")
+	if err != nil {
+		t.Fatalf("Couldn't finish job: %v", err)
+	}
+
+	interrupted, err := repo.getInterruptedJobs()
+	if err != nil {
+		t.Fatalf("Couldn't get interrupted jobs: %v", err)
+	}
+
+	if len(interrupted) != 1 || interrupted[0].id != migration.id || interrupted[0].kind != importJobKind || interrupted[0].attempts != 1 {
+		t.Fatalf("Only running migration job expected: %+v", interrupted)
+	}
+
+	err = repo.requeueJob(migration.id)
+	if err != nil {
+		t.Fatalf("Couldn't requeue job: %v", err)
+	}
+
+	migration, err = repo.claimMigrationJob()
+	if err != nil {
+		t.Fatalf("Couldn't claim requeued job: %v", err)
+	}
+
+	err = repo.finishJob(migration.id, jobFailed, "test")
+	if err != nil {
+		t.Fatalf("Couldn't finish job: %v", err)
+	}
+}
+
+func TestScheduleAnswers(t *testing.T) {
+	const scheduleUserId = 16
+
+	_, cleanup := newTestUser(t, scheduleUserId,
+		vocabWord{word: "Sperre", stem: "Sperre", lc: "de"},
+		vocabWord{word: "sogar", stem: "sogar", lc: "de"})
+	defer cleanup()
+
+	first, err := repo.getNextWord(scheduleUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get next word: %v", err)
+	}
+
+	_, err = repo.persistAnswer(guessResult{guessParams{*first, "foobar", scheduleUserId, forwardDirection, translationQuestion, "", 0, noRating}, "foobar", nil})
+	if err != nil {
+		t.Fatalf("Couldn't persist answer: %v", err)
+	}
+
+	second, err := repo.getNextWord(scheduleUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get next word: %v", err)
+	}
+
+	if second.id == first.id {
+		t.Fatalf("New word should be asked before the word due tomorrow")
+	}
+
+	_, err = repo.persistAnswer(guessResult{guessParams{*second, "!@#$%", scheduleUserId, forwardDirection, translationQuestion, "", 0, noRating}, "foobar", nil})
+	if err != nil {
+		t.Fatalf("Couldn't persist answer: %v", err)
+	}
+
+	_, err = repo.db.Exec(`
+		UPDATE word_schedules SET due_at = now() - interval '2 days' 
+		WHERE user_id=$1 AND word_id=$2`, scheduleUserId, second.id)
+	if err != nil {
+		t.Fatalf("Couldn't update due date: %v", err)
+	}
+
+	overdue, err := repo.getNextWord(scheduleUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get next word: %v", err)
+	}
+
+	if overdue.id != second.id {
+		t.Fatalf("Overdue word should be asked first")
+	}
+
+	var repetitions int
+	err = repo.db.QueryRow(`
+		SELECT repetitions FROM word_schedules 
+		WHERE user_id=$1 AND word_id=$2 AND direction=$3`, scheduleUserId, first.id, forwardDirection).Scan(&repetitions)
+	if err != nil || repetitions != 1 {
+		t.Fatalf("Correct answer should be scheduled: %d, %v", repetitions, err)
+	}
+}
+
+func TestQuestionOptions(t *testing.T) {
+	word, err := repo.getNextWord(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get next word: %v", err)
+	}
+
+	distractors, err := repo.getDistractors(testUserId, *word, 3)
+	if err != nil {
+		t.Fatalf("Couldn't get distractors: %v", err)
+	}
+
+	if len(distractors) != 3 {
+		t.Fatalf("Expected 3 distractors, got %d", len(distractors))
+	}
+
+	for _, d := range distractors {
+		if d.id == word.id || d.langId != word.langId {
+			t.Fatalf("Invalid distractor %+v for %+v", d, word)
+		}
+	}
+
+	err = repo.setQuestionOptions(testUserId, []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatalf("Couldn't set options: %v", err)
+	}
+
+	options, err := repo.getQuestionOptions(testUserId)
+	if err != nil || len(options) != 4 || options[1] != "b" {
+		t.Fatalf("Invalid options: %v, %v", options, err)
+	}
+
+	_, err = repo.getNextWord(testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get next word: %v", err)
+	}
+
+	options, err = repo.getQuestionOptions(testUserId)
+	if err != nil || options != nil {
+		t.Fatalf("Options of the previous question should be reset: %v, %v", options, err)
+	}
+}
+
+func TestMixedDirections(t *testing.T) {
+	const directionsUserId = 18
+
+	_, cleanup := newTestUser(t, directionsUserId, vocabWord{word: "Ufer", stem: "Ufer", lc: "de"})
+	defer cleanup()
+
+	err := repo.setQuizDirection(directionsUserId, mixedDirection)
+	if err != nil {
+		t.Fatalf("Couldn't set direction: %v", err)
+	}
+
+	asked := make(map[quizDirection]bool)
+	for i := 0; i < 2; i++ {
+		w, err := repo.getNextWord(directionsUserId)
+		if err != nil {
+			t.Fatalf("Couldn't get next word: %v", err)
+		}
+
+		direction, _, err := repo.getQuestionType(directionsUserId)
+		if err != nil {
+			t.Fatalf("Couldn't get question direction: %v", err)
+		}
+		asked[direction] = true
+
+		_, err = repo.persistAnswer(guessResult{guessParams{*w, "shore", directionsUserId, direction, translationQuestion, "", 0, noRating}, "shore", nil})
+		if err != nil {
+			t.Fatalf("Couldn't persist answer: %v", err)
+		}
+	}
+
+	if !asked[forwardDirection] || !asked[reverseDirection] {
+		t.Fatalf("Word should be asked in both directions: %v", asked)
+	}
+
+	var schedules int
+	err = repo.db.QueryRow("SELECT COUNT(*) FROM word_schedules WHERE user_id=$1", directionsUserId).Scan(&schedules)
+	if err != nil || schedules != 2 {
+		t.Fatalf("Each direction should have its own schedule: %d, %v", schedules, err)
+	}
+}
+
+func TestClozeMode(t *testing.T) {
+	const clozeUserId = 19
+
+	ids, cleanup := newTestUser(t, clozeUserId,
+		vocabWord{word: "Ufer", stem: "Ufer", lc: "de"},
+		vocabWord{word: "sperrte", stem: "sperren", lc: "de"})
+	defer cleanup()
+
+	wordID := ids[1]
+
+	_, err := repo.db.Exec("INSERT INTO lookups (user_id, word_id, usage) VALUES ($1, $2, $3)",
+		clozeUserId, wordID, "Er sperrte die Tür ab.")
+	if err != nil {
+		t.Fatalf("Couldn't add lookup: %v", err)
+	}
+
+	err = repo.setQuizMode(clozeUserId, clozeMode)
+	if err != nil {
+		t.Fatalf("Couldn't set mode: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		w, err := repo.getNextWord(clozeUserId)
+		if err != nil {
+			t.Fatalf("Couldn't get next word: %v", err)
+		}
+
+		if w.id != wordID {
+			t.Fatalf("Only words with usage should be asked, got %s", w.word)
+		}
+
+		direction, kind, err := repo.getQuestionType(clozeUserId)
+		if err != nil {
+			t.Fatalf("Couldn't get question type: %v", err)
+		}
+
+		if direction != reverseDirection || kind != clozeQuestion {
+			t.Fatalf("Invalid question type: %v, %v", direction, kind)
+		}
+	}
+}
+
+func TestDisputes(t *testing.T) {
+	const disputeUserId = 20
+	const reviewerUserId = 21
+
+	_, cleanup := newTestUser(t, disputeUserId, vocabWord{word: "Bank", stem: "Bank", lc: "de"})
+	defer cleanup()
+
+	_, cleanupReviewer := newTestUser(t, reviewerUserId)
+	defer cleanupReviewer()
+
+	w, err := repo.getNextWord(disputeUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get next word: %v", err)
+	}
+
+	lang, err := repo.getUserLanguage(disputeUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get user language: %v", err)
+	}
+
+	err = repo.addAcceptedTranslations(w.id, lang.id, []string{"bank", "bench"}, backendTranslation)
+	if err != nil {
+		t.Fatalf("Couldn't add translations: %v", err)
+	}
+
+	_, err = repo.addDispute(disputeUserId)
+	if err != errNoDispute {
+		t.Fatalf("User without answers can't dispute: %v", err)
+	}
+
+	_, err = repo.persistAnswer(guessResult{guessParams{*w, "shore", disputeUserId, forwardDirection, translationQuestion, "", 0, noRating}, "bank", []string{"bench"}})
+	if err != nil {
+		t.Fatalf("Couldn't persist answer: %v", err)
+	}
+
+	d, err := repo.addDispute(disputeUserId)
+	if err != nil {
+		t.Fatalf("Couldn't add dispute: %v", err)
+	}
+
+	disputes, err := repo.getPendingDisputes(maxShownDisputes)
+	if err != nil || len(disputes) != 1 || disputes[0].guess != "shore" {
+		t.Fatalf("Dispute should be pending: %v, %v", disputes, err)
+	}
+
+	_, err = repo.resolveDispute(d.id, reviewerUserId, disputeAccepted)
+	if err != nil {
+		t.Fatalf("Couldn't resolve dispute: %v", err)
+	}
+
+	var streak, repetitions, incorrect int
+	err = repo.db.QueryRow(`
+		SELECT streak, repetitions, incorrect_answers 
+		FROM word_schedules 
+		WHERE user_id=$1 AND word_id=$2 AND direction=$3`, disputeUserId, w.id, forwardDirection).Scan(&streak, &repetitions, &incorrect)
+	if err != nil || streak != 1 || repetitions != 1 || incorrect != 0 {
+		t.Fatalf("Accepted answer should be scheduled as correct: %d, %d, %d, %v", streak, repetitions, incorrect, err)
+	}
+
+	_, err = repo.resolveDispute(d.id, reviewerUserId, disputeRejected)
+	if err != errNotReviewed {
+		t.Fatalf("Dispute can't be reviewed twice: %v", err)
+	}
+
+	translations, err := repo.getAcceptedTranslations(w.id, lang.id)
+	if err != nil {
+		t.Fatalf("Couldn't get translations: %v", err)
+	}
+
+	_, err = repo.persistAnswer(guessResult{guessParams{*w, "bench", disputeUserId, forwardDirection, choiceQuestion, "", 0, noRating}, "bank", nil})
+	if err != nil {
+		t.Fatalf("Couldn't persist answer: %v", err)
+	}
+
+	_, err = repo.addDispute(disputeUserId)
+	if err != errNoDispute {
+		t.Fatalf("Chosen options can't be disputed: %v", err)
+	}
+
+	expected := []string{"bank", "bench", "shore"}
+	if !reflect.DeepEqual(translations, expected) {
+		t.Fatalf("Accepted answer should be added to translations: %v", translations)
+	}
+
+	cached, err := repo.getCachedTranslations([]int{w.id, w.id + 1000}, lang.id)
+	if err != nil || !reflect.DeepEqual(cached, map[int]string{w.id: "bank"}) {
+		t.Fatalf("Only the machine translation should be cached: %v, %v", cached, err)
+	}
+}
+
+func TestQuizSession(t *testing.T) {
+	const sessionUserId = 22
+
+	_, cleanup := newTestUser(t, sessionUserId, vocabWord{word: "Ufer", stem: "Ufer", lc: "de"})
+	defer cleanup()
+
+	for i, guess := range []string{"shore", "bank"} {
+		_, err := repo.startSession(sessionUserId, 2)
+		if err != nil {
+			t.Fatalf("Couldn't start session: %v", err)
+		}
+
+		_, err = repo.startSession(sessionUserId, 2)
+		if err != errSessionActive {
+			t.Fatalf("Only one session can be active: %v", err)
+		}
+
+		w, err := repo.getNextWord(sessionUserId)
+		if err != nil {
+			t.Fatalf("Couldn't get next word: %v", err)
+		}
+
+		_, err = repo.persistAnswer(guessResult{guessParams{*w, guess, sessionUserId, forwardDirection, translationQuestion, "", 0, noRating}, "shore", nil})
+		if err != nil {
+			t.Fatalf("Couldn't persist answer: %v", err)
+		}
+
+		s, err := repo.getActiveSession(sessionUserId)
+		if err != nil || s.asked != 1 {
+			t.Fatalf("Answer should be counted in the session: %v, %v", s, err)
+		}
+
+		summary, err := repo.finishSession(sessionUserId, sessionStopped)
+		if err != nil {
+			t.Fatalf("Couldn't finish session: %v", err)
+		}
+
+		if i == 0 && (summary.session.correct != 1 || summary.previous != nil) {
+			t.Fatalf("Invalid first session summary: %v", summary)
+		}
+
+		if i == 1 && (len(summary.missed) != 1 || summary.missed[0] != "Ufer" || summary.previous == nil || summary.previous.correct != 1) {
+			t.Fatalf("Invalid second session summary: %v", summary)
+		}
+	}
+
+	_, err := repo.getActiveSession(sessionUserId)
+	if err != errNoSession {
+		t.Fatalf("Session should be finished: %v", err)
+	}
+}
+
+func TestQuestionHints(t *testing.T) {
+	const hintsUserId = 23
+
+	_, cleanup := newTestUser(t, hintsUserId, vocabWord{word: "Ufer", stem: "Ufer", lc: "de"})
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		_, err := repo.getNextWord(hintsUserId)
+		if err != nil {
+			t.Fatalf("Couldn't get next word: %v", err)
+		}
+
+		hints, err := repo.getQuestionHints(hintsUserId)
+		if err != nil || hints != 0 {
+			t.Fatalf("New question should have no hints: %d, %v", hints, err)
+		}
+
+		for expected := 1; expected <= 2; expected++ {
+			hints, err = repo.addQuestionHint(hintsUserId)
+			if err != nil || hints != expected {
+				t.Fatalf("Hint should be counted: %d, %v", hints, err)
+			}
+		}
+	}
+}
+
+func TestFlashcardMode(t *testing.T) {
+	const cardsUserId = 24
+
+	_, cleanup := newTestUser(t, cardsUserId, vocabWord{word: "Ufer", stem: "Ufer", lc: "de"})
+	defer cleanup()
+
+	err := repo.setQuizMode(cardsUserId, flashcardMode)
+	if err != nil {
+		t.Fatalf("Couldn't set mode: %v", err)
+	}
+
+	w, err := repo.getNextWord(cardsUserId)
+	if err != nil {
+		t.Fatalf("Couldn't get next word: %v", err)
+	}
+
+	direction, kind, err := repo.getQuestionType(cardsUserId)
+	if err != nil || kind != flashcardQuestion {
+		t.Fatalf("Flashcard should be asked: %v, %v", kind, err)
+	}
+
+	_, err = repo.persistAnswer(guessResult{guessParams{*w, "", cardsUserId, direction, kind, "", 0, ratingEasy}, "shore", nil})
+	if err != nil {
+		t.Fatalf("Couldn't persist answer: %v", err)
+	}
+
+	var rating string
+	var grade answerGrade
+	err = repo.db.QueryRow("SELECT rating, grade FROM answers WHERE user_id=$1", cardsUserId).Scan(&rating, &grade)
+	if err != nil || cardRating(rating) != ratingEasy || grade != gradeCorrect {
+		t.Fatalf("Rating should be stored with the answer: %s, %v, %v", rating, grade, err)
+	}
+}
+
+func TestRetireWords(t *testing.T) {
+	const retireUserId = 25
+
+	_, cleanup := newTestUser(t, retireUserId, vocabWord{word: "Ufer", stem: "Ufer", lc: "de"})
+	defer cleanup()
+
+	err := repo.setMasteryThreshold(retireUserId, 2)
+	if err != nil {
+		t.Fatalf("Couldn't set mastery threshold: %v", err)
+	}
+
+	for i, guess := range []string{"shore", "bank", "shore", "shore"} {
+		w, err := repo.getNextWord(retireUserId)
+		if err != nil {
+			t.Fatalf("Word shouldn't be retired before answer %d: %v", i, err)
+		}
+
+		retired, err := repo.persistAnswer(guessResult{guessParams{*w, guess, retireUserId, forwardDirection, translationQuestion, "", 0, noRating}, "shore", nil})
+		if err != nil {
+			t.Fatalf("Couldn't persist answer: %v", err)
+		}
+
+		if retired != (i == 3) {
+			t.Fatalf("Word should be retired only after 2 correct answers in a row, answer %d", i)
+		}
+	}
+
+	_, err = repo.getNextWord(retireUserId)
+	if err != errNoWordsFound {
+		t.Fatalf("Retired word shouldn't be asked: %v", err)
+	}
+
+	_, err = repo.toggleIncludeMastered(retireUserId)
+	if err != nil {
+		t.Fatalf("Couldn't include mastered words: %v", err)
+	}
+
+	_, err = repo.getNextWord(retireUserId)
+	if err != nil {
+		t.Fatalf("Retired word should be asked with mastered words: %v", err)
+	}
+
+	err = repo.setMasteryThreshold(retireUserId, 5)
+	if err != nil {
+		t.Fatalf("Couldn't set mastery threshold: %v", err)
+	}
+
+	//The streak is over the lowered threshold before the answer
+	for i, guess := range []string{"bank", "shore", "shore", "shore", "shore"} {
+		if i == 4 {
+			err = repo.setMasteryThreshold(retireUserId, 2)
+			if err != nil {
+				t.Fatalf("Couldn't set mastery threshold: %v", err)
+			}
+		}
+
+		w, err := repo.getNextWord(retireUserId)
+		if err != nil {
+			t.Fatalf("Word shouldn't be retired before answer %d: %v", i, err)
+		}
+
+		retired, err := repo.persistAnswer(guessResult{guessParams{*w, guess, retireUserId, forwardDirection, translationQuestion, "", 0, noRating}, "shore", nil})
+		if err != nil {
+			t.Fatalf("Couldn't persist answer: %v", err)
+		}
+
+		if retired != (i == 4) {
+			t.Fatalf("Word should be retired after the threshold is lowered, answer %d", i)
+		}
+	}
+}
+
+func TestErrorWeightedWords(t *testing.T) {
+	const weightedUserId = 26
+
+	ids, cleanup := newTestUser(t, weightedUserId,
+		vocabWord{word: "Ufer", stem: "Ufer", lc: "de"},
+		vocabWord{word: "sogar", stem: "sogar", lc: "de"})
+	defer cleanup()
+
+	_, err := repo.db.Exec(`
+		INSERT INTO word_schedules (user_id, word_id, direction, due_at, last_answered_at, correct_answers, incorrect_answers) 
+		VALUES ($1, $2, 0, now() - interval '1 day', now() - interval '2 days', 0, 10), 
+		       ($1, $3, 0, now() - interval '1 day', now() - interval '2 days', 10, 0)`,
+		weightedUserId, ids[0], ids[1])
+	if err != nil {
+		t.Fatalf("Couldn't add schedules: %v", err)
+	}
+
+	missed := 0
+	for i := 0; i < 20; i++ {
+		w, err := repo.getNextWord(weightedUserId)
+		if err != nil {
+			t.Fatalf("Couldn't get next word: %v", err)
+		}
+
+		if w.id == ids[0] {
+			missed++
+		}
+	}
+
+	if missed < 12 {
+		t.Fatalf("Word answered incorrectly should be asked more often: %d of 20", missed)
+	}
+}
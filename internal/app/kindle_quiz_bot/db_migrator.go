@@ -1,30 +1,376 @@
 package kindle_quiz_bot
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"os"
+	"strings"
+	"time"
 )
 
-func migrateFromKindleSQLite(sqlitePath string, userId int, repo *repository) error {
-	db, err := sql.Open("sqlite3", sqlitePath)
+// unknownLangCode lets translation backend detect the language
+// of words imported without language code.
+const unknownLangCode = "auto"
+
+// Kindle WORDS.category values
+const (
+	kindleCategoryLearning = 0
+	kindleCategoryMastered = 100
+)
+
+type importStats struct {
+	batchID int
+	words   int
+	lookups int
+}
+
+// importBatch is a record of the import, words introduced by it can be removed.
+type importBatch struct {
+	id           int
+	createdAt    time.Time
+	fileHash     string
+	wordsCount   int
+	lookupsCount int
+}
+
+// importProgress keeps the newest Kindle timestamps imported
+// for the device profile, so re-uploads import only newer rows.
+type importProgress struct {
+	profileID       string
+	wordTimestamp   int64
+	lookupTimestamp int64
+}
+
+// vocabulary is a part of device vocabulary prepared for the bulk import.
+type vocabulary struct {
+	fileHash string
+	words    []vocabWord
+	lookups  []vocabLookup
+	books    []book
+	progress []importProgress
+}
+
+// vocabLookup is a sentence the word was looked up in.
+type vocabLookup struct {
+	word      vocabWord
+	usage     string
+	bookKey   string
+	pos       string
+	timestamp int64
+}
+
+type uploadType int
+
+const (
+	unknownUpload uploadType = iota
+	sqliteUpload
+	clippingsUpload
+)
+
+// deviceProfile is a Kindle profile found in vocab.db,
+// household members have separate profiles on one device.
+type deviceProfile struct {
+	id         string
+	wordsCount int
+}
+
+// detectUploadType tells sqlite database from "My Clippings.txt" by file contents,
+// file names are changed by Telegram clients.
+func detectUploadType(path string) (uploadType, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("db migration: %v", err.Error())
+		return unknownUpload, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 64<<10)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return unknownUpload, err
+	}
+	head = head[:n]
+
+	if bytes.HasPrefix(head, sqliteHeader) {
+		return sqliteUpload, nil
+	}
+
+	if bytes.Contains(head, []byte(clippingsSeparator)) {
+		return clippingsUpload, nil
+	}
+
+	return unknownUpload, nil
+}
+
+// migrateUpload imports uploaded file with the importer of its type,
+// profiles are used by sqlite databases only.
+func migrateUpload(path string, userId int, repo *repository, profiles []string) (importStats, error) {
+	t, err := detectUploadType(path)
+	if err != nil {
+		return importStats{}, err
+	}
+
+	switch t {
+	case sqliteUpload:
+		return migrateFromSQLite(path, userId, repo, profiles)
+	case clippingsUpload:
+		return migrateFromClippings(path, userId, repo)
+	}
+
+	return importStats{}, fmt.Errorf("db migration: unknown file format")
+}
+
+// readUpload reads the part of uploaded file which is going to be imported
+// and count of all words in the file.
+func readUpload(path string, userId int, repo *repository, profiles []string) (*vocabulary, int, error) {
+	t, err := detectUploadType(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if t == clippingsUpload {
+		return readClippingsVocabulary(path, userId, repo)
+	}
+
+	db, err := openVocabDB(path)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer db.Close()
 
-	langs, err := repo.getLanguages()
+	imp, err := detectImporter(db)
 	if err != nil {
-		return fmt.Errorf("get languages: %v", err.Error())
+		return nil, 0, err
 	}
-	langMap := make(map[string]int, len(langs))
-	for _, l := range langs {
-		langMap[l.code] = l.id
+
+	v, err := readVocabulary(db, imp, userId, repo, profiles)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found, err := imp.profiles(db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := 0
+	for _, p := range found {
+		for _, id := range profiles {
+			if p.id == id {
+				total += p.wordsCount
+			}
+		}
 	}
 
-	rows, err := db.Query("SELECT word, stem, lang FROM WORDS")
+	return v, total, nil
+}
+
+// migrateFromSQLite imports words of the profiles from e-reader vocabulary database,
+// nil profiles imports all of them.
+func migrateFromSQLite(sqlitePath string, userId int, repo *repository, profiles []string) (importStats, error) {
+	db, err := openVocabDB(sqlitePath)
+	if err != nil {
+		return importStats{}, fmt.Errorf("db migration: %v", err.Error())
+	}
+	defer db.Close()
+
+	imp, err := detectImporter(db)
 	if err != nil {
-		return fmt.Errorf("sqlite: querying words: %v", err.Error())
+		return importStats{}, fmt.Errorf("db migration: %v", err.Error())
+	}
+
+	if profiles == nil {
+		found, err := imp.profiles(db)
+		if err != nil {
+			return importStats{}, err
+		}
+
+		for _, p := range found {
+			profiles = append(profiles, p.id)
+		}
+	}
+
+	v, err := readVocabulary(db, imp, userId, repo, profiles)
+	if err != nil {
+		return importStats{}, err
+	}
+
+	v.fileHash, err = fileHash(sqlitePath)
+	if err != nil {
+		return importStats{}, err
+	}
+
+	return repo.importVocabulary(userId, *v)
+}
+
+// readVocabulary reads books and the rows newer than
+// user's import progress for the profiles.
+func readVocabulary(db *sql.DB, imp vocabImporter, userId int, repo *repository, profiles []string) (*vocabulary, error) {
+	books, err := imp.books(db)
+	if err != nil {
+		return nil, err
+	}
+
+	v := vocabulary{books: books}
+
+	categories, err := repo.getUserWordCategories(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, profileID := range profiles {
+		progress, err := repo.getImportProgress(userId, profileID)
+		if err != nil {
+			return nil, err
+		}
+
+		//Words marked as mastered keep their timestamp, so every word is read
+		words, err := imp.words(db, importProgress{profileID: profileID})
+		if err != nil {
+			return nil, err
+		}
+		words = syncedWords(words, *progress, categories)
+
+		lookups, err := imp.lookups(db, *progress)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, w := range words {
+			if w.timestamp > progress.wordTimestamp {
+				progress.wordTimestamp = w.timestamp
+			}
+		}
+
+		for _, l := range lookups {
+			if l.timestamp > progress.lookupTimestamp {
+				progress.lookupTimestamp = l.timestamp
+			}
+		}
+
+		v.words = append(v.words, words...)
+		v.lookups = append(v.lookups, lookups...)
+		v.progress = append(v.progress, *progress)
+	}
+
+	err = fillMissingLanguage(&v, userId, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// syncedWords keeps the words newer than the progress and the known words
+// whose category was changed on the device.
+func syncedWords(words []vocabWord, p importProgress, categories map[string]int) []vocabWord {
+	synced := make([]vocabWord, 0, len(words))
+	for _, w := range words {
+		category, known := categories[wordKey(w.word, w.stem, w.lc)]
+		if w.timestamp > p.wordTimestamp || (known && category != w.category) {
+			synced = append(synced, w)
+		}
+	}
+	return synced
+}
+
+// fillMissingLanguage sets user's source language to the words
+// of databases which don't keep word languages.
+func fillMissingLanguage(v *vocabulary, userId int, repo *repository) error {
+	lc := ""
+	fill := func(code *string) error {
+		if *code != "" {
+			return nil
+		}
+
+		if lc == "" {
+			var err error
+			lc, err = repo.getUserSourceLang(userId)
+			if err != nil {
+				return err
+			}
+		}
+
+		*code = lc
+		return nil
+	}
+
+	for i := range v.words {
+		err := fill(&v.words[i].lc)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range v.lookups {
+		err := fill(&v.lookups[i].word.lc)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range v.books {
+		err := fill(&v.books[i].lang)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func normalizeLangCode(lc string) string {
+	lc = strings.ToLower(strings.TrimSpace(lc))
+	if lc == "" {
+		return unknownLangCode
+	}
+	return lc
+}
+
+// readProfiles lists profiles of the vocabulary database with their words counts.
+func readProfiles(sqlitePath string) ([]deviceProfile, error) {
+	db, err := openVocabDB(sqlitePath)
+	if err != nil {
+		return nil, fmt.Errorf("db migration: %v", err.Error())
+	}
+	defer db.Close()
+
+	imp, err := detectImporter(db)
+	if err != nil {
+		return nil, fmt.Errorf("db migration: %v", err.Error())
+	}
+
+	return imp.profiles(db)
+}
+
+func kindleProfiles(db *sql.DB) ([]deviceProfile, error) {
+	rows, err := db.Query(`
+		SELECT COALESCE(profileid, ''), COUNT(*) 
+		FROM WORDS 
+		GROUP BY COALESCE(profileid, '') 
+		ORDER BY COUNT(*) DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying profiles: %v", err.Error())
 	}
 	defer func() {
 		err = rows.Close()
@@ -34,26 +380,149 @@ func migrateFromKindleSQLite(sqlitePath string, userId int, repo *repository) er
 		}
 	}()
 
+	profiles := make([]deviceProfile, 0)
+
 	for rows.Next() {
 		err := rows.Err()
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		p := deviceProfile{}
+		err = rows.Scan(&p.id, &p.wordsCount)
+		if err != nil {
+			return nil, fmt.Errorf("migration: scan profile: %v", err.Error())
+		}
+		profiles = append(profiles, p)
+	}
+
+	return profiles, nil
+}
+
+// readKindleBooks reads Kindle BOOK_INFO rows, lookups
+// are linked to the books with book keys.
+func readKindleBooks(db *sql.DB) ([]book, error) {
+	rows, err := db.Query("SELECT id, asin, title, authors, lang FROM BOOK_INFO")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying books: %v", err.Error())
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			//TODO: error handle
+			fmt.Printf("sqlite rows close: %v", err)
 		}
+	}()
 
-		var lc string
-		w := word{}
-		err = rows.Scan(&w.word, &w.stem, &lc)
+	books := make([]book, 0)
+
+	for rows.Next() {
+		err := rows.Err()
 		if err != nil {
-			return fmt.Errorf("migration: scan word: %v", err.Error())
+			return nil, err
 		}
 
-		err = repo.addWordForUser(userId, w, lc)
+		var asin, title, authors, lc sql.NullString
+		b := book{}
+		err = rows.Scan(&b.key, &asin, &title, &authors, &lc)
 		if err != nil {
-			return fmt.Errorf("migration: add word: %v", err.Error())
+			return nil, fmt.Errorf("migration: scan book: %v", err.Error())
 		}
+
+		b.asin = asin.String
+		b.title = title.String
+		b.authors = authors.String
+		b.lang = lc.String
+
+		books = append(books, b)
 	}
 
-	return nil
+	return books, nil
+}
+
+// readKindleWords reads profile's Kindle WORDS rows newer than the progress.
+func readKindleWords(db *sql.DB, p importProgress) ([]vocabWord, error) {
+	rows, err := db.Query(`
+		SELECT word, stem, lang, category, timestamp 
+		FROM WORDS 
+		WHERE COALESCE(profileid, '')=? AND timestamp > ?`, p.profileID, p.wordTimestamp)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying words: %v", err.Error())
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			//TODO: error handle
+			fmt.Printf("sqlite rows close: %v", err)
+		}
+	}()
+
+	words := make([]vocabWord, 0)
+
+	for rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var category, timestamp sql.NullInt64
+		w := vocabWord{}
+		err = rows.Scan(&w.word, &w.stem, &w.lc, &category, &timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("migration: scan word: %v", err.Error())
+		}
+
+		w.category = int(category.Int64)
+		w.timestamp = timestamp.Int64
+
+		words = append(words, w)
+	}
+
+	return words, nil
 }
 
+// readKindleLookups reads the sentences from Kindle LOOKUPS
+// table newer than the progress along with their words.
+func readKindleLookups(db *sql.DB, p importProgress) ([]vocabLookup, error) {
+	rows, err := db.Query(`
+		SELECT w.word, w.stem, w.lang, l.usage, l.book_key, l.pos, l.timestamp 
+		FROM LOOKUPS l 
+		JOIN WORDS w ON w.id = l.word_key 
+		WHERE COALESCE(w.profileid, '')=? AND l.timestamp > ?`, p.profileID, p.lookupTimestamp)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying lookups: %v", err.Error())
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			//TODO: error handle
+			fmt.Printf("sqlite rows close: %v", err)
+		}
+	}()
 
+	lookups := make([]vocabLookup, 0)
+
+	for rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var usage, bookKey, pos sql.NullString
+		var timestamp sql.NullInt64
+		l := vocabLookup{}
+		err = rows.Scan(&l.word.word, &l.word.stem, &l.word.lc, &usage, &bookKey, &pos, &timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("migration: scan lookup: %v", err.Error())
+		}
+
+		l.usage = usage.String
+		l.bookKey = bookKey.String
+		l.pos = pos.String
+		l.timestamp = timestamp.Int64
+
+		lookups = append(lookups, l)
+	}
+
+	return lookups, nil
+}
@@ -95,7 +95,7 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Could not create test user: %v", err)
 	}
 
-	err = migrateFromKindleSQLite("../../../test/data/vocab.db", testUserId, &repo)
+	_, err = migrateFromSQLite("../../../test/data/vocab.db", testUserId, &repo, nil)
 	if err != nil {
 		log.Fatalf("Could not migrate from sql")
 	}
@@ -115,3 +115,106 @@ func TestMain(m *testing.M) {
 
 	os.Exit(code)
 }
+
+func TestIncrementalMigration(t *testing.T) {
+	stats, err := migrateFromSQLite("../../../test/data/vocab.db", testUserId, &repo, nil)
+	if err != nil {
+		t.Fatalf("Couldn't migrate again: %v", err)
+	}
+
+	if stats.words != 0 || stats.lookups != 0 {
+		t.Fatalf("Nothing should be imported twice, got %d words, %d lookups", stats.words, stats.lookups)
+	}
+
+	//Category changed on the device is synced for the imported words
+	_, err = repo.db.Exec("UPDATE user_words SET category=-1 WHERE user_id=$1", testUserId)
+	if err != nil {
+		t.Fatalf("Couldn't change categories: %v", err)
+	}
+
+	_, err = migrateFromSQLite("../../../test/data/vocab.db", testUserId, &repo, nil)
+	if err != nil {
+		t.Fatalf("Couldn't migrate again: %v", err)
+	}
+
+	var stale int
+	err = repo.db.QueryRow("SELECT COUNT(*) FROM user_words WHERE user_id=$1 AND category=-1", testUserId).Scan(&stale)
+	if err != nil || stale != 0 {
+		t.Fatalf("Changed categories should be synced: %d stale, %v", stale, err)
+	}
+}
+
+func TestSyncedWords(t *testing.T) {
+	words := []vocabWord{
+		{word: "neu", stem: "neu", lc: "de", timestamp: 3},
+		{word: "alt", stem: "alt", lc: "de", category: kindleCategoryMastered, timestamp: 1},
+		{word: "gleich", stem: "gleich", lc: "de", timestamp: 1},
+		{word: "fremd", stem: "fremd", lc: "de", category: kindleCategoryMastered, timestamp: 1},
+	}
+	categories := map[string]int{
+		wordKey("alt", "alt", "de"):       kindleCategoryLearning,
+		wordKey("gleich", "gleich", "de"): kindleCategoryLearning,
+	}
+
+	synced := syncedWords(words, importProgress{wordTimestamp: 2}, categories)
+	if len(synced) != 2 || synced[0].word != "neu" || synced[1].word != "alt" {
+		t.Fatalf("Only new and changed words should be synced: %v", synced)
+	}
+}
+
+func TestReadProfiles(t *testing.T) {
+	profiles, err := readProfiles("../../../test/data/vocab.db")
+	if err != nil {
+		t.Fatalf("Couldn't read profiles: %v", err)
+	}
+
+	if len(profiles) != 2 {
+		t.Fatalf("Expected 2 profiles, got %d", len(profiles))
+	}
+
+	wordsCount := 0
+	for _, p := range profiles {
+		wordsCount += p.wordsCount
+	}
+
+	if wordsCount != 841 {
+		t.Fatalf("Invalid words count: %d", wordsCount)
+	}
+}
+
+func TestMigrateFromOtherDevices(t *testing.T) {
+	const userId = 12
+
+	_, err := repo.createUser(userId)
+	if err != nil {
+		t.Fatalf("Couldn't create user: %v", err)
+	}
+
+	stats, err := migrateFromSQLite("../../../test/data/KoboReader.sqlite", userId, &repo, nil)
+	if err != nil {
+		t.Fatalf("Couldn't migrate from kobo: %v", err)
+	}
+
+	if stats.words != 5 {
+		t.Fatalf("Invalid kobo words count: %d", stats.words)
+	}
+
+	stats, err = migrateFromSQLite("../../../test/data/vocabulary_builder.sqlite3", userId, &repo, nil)
+	if err != nil {
+		t.Fatalf("Couldn't migrate from koreader: %v", err)
+	}
+
+	if stats.words != 4 || stats.lookups != 4 {
+		t.Fatalf("Invalid koreader counts: %d words, %d lookups", stats.words, stats.lookups)
+	}
+
+	//Most of kobo words are german, so koreader words are german too
+	lc, err := repo.getUserSourceLang(userId)
+	if err != nil {
+		t.Fatalf("Couldn't get source language: %v", err)
+	}
+
+	if lc != "de" {
+		t.Fatalf("Invalid source language: %s", lc)
+	}
+}
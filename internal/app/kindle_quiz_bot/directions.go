@@ -0,0 +1,105 @@
+package kindle_quiz_bot
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// quizDirection is a way the word is asked, mixedDirection is
+// a user setting only, every question has forward or reverse direction.
+type quizDirection int
+
+const (
+	forwardDirection quizDirection = iota
+	reverseDirection
+	mixedDirection
+)
+
+var quizDirections = []struct {
+	direction   quizDirection
+	name        string
+	description string
+}{
+	{forwardDirection, "forward", "translate the word from your books"},
+	{reverseDirection, "reverse", "recall the word from its translation"},
+	{mixedDirection, "mixed", "both directions"},
+}
+
+func (q *quiz) SelectDirection(userId int, arg string) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+
+	for _, d := range quizDirections {
+		if d.name != arg {
+			continue
+		}
+
+		err := q.repo.setQuizDirection(userId, d.direction)
+		if err != nil {
+			log.Printf("select direction: %v", err)
+			return //TODO: error handle
+		}
+
+		q.sendMessage(userId, fmt.Sprintf("Quiz direction: %s. Press /quiz to start.", d.name))
+		return
+	}
+
+	msg := "Quiz directions:\n\n"
+	for _, d := range quizDirections {
+		msg += fmt.Sprintf("%s - %s\n", d.name, d.description)
+	}
+	msg += "\nRun /direction <name> to switch."
+	q.sendMessage(userId, msg)
+}
+
+// reverseQuestion shows the translation, the word is hidden in the usage sentence.
+func reverseQuestion(translation, usage string, w word, l *lang) string {
+	question := fmt.Sprintf("Translation is: %s; Lang: %s\n", translation, l.englishName)
+	if usage != "" {
+		question += fmt.Sprintf("\nContext: %s\n", maskWord(usage, w.word))
+	}
+	question += fmt.Sprintf("\nType the %s word:", l.englishName)
+	return question
+}
+
+func maskWord(sentence, w string) string {
+	sentence = strings.TrimSpace(sentence)
+
+	masked := ""
+	last := 0
+	for _, loc := range wordIndexes(sentence, w) {
+		masked += sentence[last:loc[0]] + "___"
+		last = loc[1]
+	}
+
+	return masked + sentence[last:]
+}
+
+// wordIndexes finds case-insensitive occurrences of the whole word,
+// the matches inside other words are skipped.
+func wordIndexes(sentence, w string) [][]int {
+	if w == "" {
+		return nil
+	}
+
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(w))
+
+	indexes := make([][]int, 0)
+	for _, loc := range re.FindAllStringIndex(sentence, -1) {
+		before, _ := utf8.DecodeLastRuneInString(sentence[:loc[0]])
+		after, _ := utf8.DecodeRuneInString(sentence[loc[1]:])
+		if isWordRune(before) || isWordRune(after) {
+			continue
+		}
+		indexes = append(indexes, loc)
+	}
+
+	return indexes
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r)
+}
@@ -0,0 +1,58 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestMaskWord(t *testing.T) {
+	masked := maskWord(" Er sperrte die Tür ab, sperrte sie zu. ", "sperrte")
+	if masked != "Er ___ die Tür ab, ___ sie zu." {
+		t.Fatalf("Invalid masked sentence: %s", masked)
+	}
+
+	cases := []struct {
+		sentence, word, expected string
+	}{
+		{"Nothing in the bank", "in", "Nothing ___ the bank"},
+		{"In Ruhe, in Frieden.", "in", "___ Ruhe, ___ Frieden."},
+		{"Die Bank und die Bänke", "bank", "Die ___ und die Bänke"},
+		{"Das Überall", "über", "Das Überall"},
+	}
+
+	for _, c := range cases {
+		masked := maskWord(c.sentence, c.word)
+		if masked != c.expected {
+			t.Fatalf("Expected %q, got %q", c.expected, masked)
+		}
+	}
+}
+
+func TestReverseGuess(t *testing.T) {
+	w := word{word: "sperrte", stem: "Sperre"}
+
+	cases := []struct {
+		guess   string
+		correct bool
+	}{
+		{"sperrte", true},
+		{" sperre ", true},
+		{"locked", false},
+	}
+
+	for _, c := range cases {
+		r := guessResult{guessParams{w, c.guess, 0, reverseDirection, translationQuestion, "", 0, noRating}, "locked", nil}
+		if r.correct() != c.correct {
+			t.Fatalf("Invalid result for %q", c.guess)
+		}
+	}
+
+	r := guessResult{guessParams{w, "locked", 0, reverseDirection, translationQuestion, "", 0, noRating}, "locked", nil}
+	if r.answer() != "sperrte (Sperre)" {
+		t.Fatalf("Invalid answer: %s", r.answer())
+	}
+
+	r.params.direction = forwardDirection
+	if !r.correct() || r.answer() != "locked" {
+		t.Fatalf("Forward guess should be compared with translation")
+	}
+}
@@ -0,0 +1,175 @@
+package kindle_quiz_bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	disputeCallbackPrefix = "dispute"
+	maxShownDisputes      = 10
+)
+
+type disputeStatus string
+
+const (
+	disputePending  disputeStatus = "pending"
+	disputeAccepted disputeStatus = "accepted"
+	disputeRejected disputeStatus = "rejected"
+)
+
+// dispute is a request to accept the guess marked incorrect as a translation.
+type dispute struct {
+	id       int
+	status   disputeStatus
+	answerID int
+	userID   int
+	wordID   int
+	word     string
+	langID   int
+	guess    string
+}
+
+// DisputeAnswer sends the last incorrect answer of the user to reviewers.
+func (q *quiz) DisputeAnswer(userId int) {
+	d, err := q.repo.addDispute(userId)
+	if err == errNoDispute {
+		q.sendMessage(userId, "Only the last incorrect translation can be disputed.")
+		return
+	}
+	if err != nil {
+		log.Printf("dispute answer: %v", err)
+		q.sendMessage(userId, "Couldn't send the answer for review, try again later.")
+		return
+	}
+
+	if d.status != disputePending {
+		q.sendMessage(userId, fmt.Sprintf("The answer is already reviewed: %s.", d.status))
+		return
+	}
+
+	q.sendMessage(userId, fmt.Sprintf("Your answer %q for %q is sent for review.", d.guess, d.word))
+
+	reviewers, err := q.repo.getReviewers()
+	if err != nil {
+		log.Printf("dispute answer: %v", err)
+		return
+	}
+
+	for _, r := range reviewers {
+		q.sendDispute(r, *d)
+	}
+}
+
+// ShowDisputes lists pending disputes to the reviewer.
+func (q *quiz) ShowDisputes(userId int) {
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("show disputes: %v", err)
+		return //TODO: error handle
+	}
+
+	if !u.reviewer {
+		q.sendMessage(userId, "Only reviewers can see disputed answers.")
+		return
+	}
+
+	disputes, err := q.repo.getPendingDisputes(maxShownDisputes)
+	if err != nil {
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	if len(disputes) == 0 {
+		q.sendMessage(userId, "There are no disputed answers.")
+		return
+	}
+
+	for _, d := range disputes {
+		q.sendDispute(userId, d)
+	}
+}
+
+func (q *quiz) sendDispute(reviewerId int, d dispute) {
+	translations, err := q.repo.getAcceptedTranslations(d.wordID, d.langID)
+	if err != nil {
+		log.Printf("send dispute: %v", err)
+	}
+
+	text := fmt.Sprintf("Word: %s\nAccepted: %s\nDisputed answer: %s",
+		d.word, strings.Join(translations, ", "), d.guess)
+	rows := [][]button{{
+		{text: "Accept", data: disputeCallbackData(d.id, disputeAccepted)},
+		{text: "Reject", data: disputeCallbackData(d.id, disputeRejected)},
+	}}
+
+	err = q.sender.SendKeyboard(reviewerId, text, rows)
+	if err != nil {
+		log.Printf("send dispute: %v", err)
+	}
+}
+
+// reviewDispute accepts or rejects the dispute from the reviewer's button
+// and tells the result to the user who disputed.
+func (q *quiz) reviewDispute(userId int, data string) {
+	id, status, err := parseDisputeCallback(data)
+	if err != nil {
+		log.Printf("review dispute: %v: %s", err, data)
+		return
+	}
+
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("review dispute: %v", err)
+		return //TODO: error handle
+	}
+
+	if !u.reviewer {
+		q.sendMessage(userId, "Only reviewers can review disputed answers.")
+		return
+	}
+
+	d, err := q.repo.resolveDispute(id, userId, status)
+	if err == errNotReviewed {
+		q.sendMessage(userId, "The dispute is already reviewed.")
+		return
+	}
+	if err != nil {
+		log.Printf("review dispute: %v", err)
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	q.sendMessage(userId, fmt.Sprintf("%q for %q is %s.", d.guess, d.word, d.status))
+
+	if d.status == disputeAccepted {
+		q.sendMessage(d.userID, fmt.Sprintf("Your answer %q for %q is accepted and will be counted as correct.", d.guess, d.word))
+	} else {
+		q.sendMessage(d.userID, fmt.Sprintf("Your answer %q for %q is rejected by the reviewer.", d.guess, d.word))
+	}
+}
+
+func disputeCallbackData(id int, status disputeStatus) string {
+	return fmt.Sprintf("%s:%d:%s", disputeCallbackPrefix, id, status)
+}
+
+func parseDisputeCallback(data string) (int, disputeStatus, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != disputeCallbackPrefix {
+		return 0, "", errInvalidCallback
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, "", errInvalidCallback
+	}
+
+	status := disputeStatus(parts[2])
+	if status != disputeAccepted && status != disputeRejected {
+		return 0, "", errInvalidCallback
+	}
+
+	return id, status, nil
+}
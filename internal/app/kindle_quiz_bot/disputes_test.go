@@ -0,0 +1,19 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestParseDisputeCallback(t *testing.T) {
+	id, status, err := parseDisputeCallback(disputeCallbackData(12, disputeAccepted))
+	if err != nil || id != 12 || status != disputeAccepted {
+		t.Fatalf("Invalid dispute callback: %d, %s, %v", id, status, err)
+	}
+
+	for _, data := range []string{"dispute:12:pending", "dispute:x:accepted", "choice:12:0", "dispute:12"} {
+		_, _, err := parseDisputeCallback(data)
+		if err != errInvalidCallback {
+			t.Fatalf("Callback %q should be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package kindle_quiz_bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	downloadAttempts  = 4
+	downloadTimeout   = 2 * time.Minute
+	downloadBaseDelay = time.Second
+	downloadMaxDelay  = 30 * time.Second
+)
+
+var errDownloadTooLarge = errors.New("document is too large")
+
+// downloadError is a failed download attempt, temporary errors are retried.
+// Only the reason is kept, http client errors have the url with the bot token.
+type downloadError struct {
+	reason    string
+	temporary bool
+}
+
+func (e *downloadError) Error() string {
+	return e.reason
+}
+
+// downloader fetches documents with retries, exponential backoff and jitter.
+type downloader struct {
+	client    *http.Client
+	maxSize   int64
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	sleep     func(time.Duration)
+}
+
+func newDownloader() *downloader {
+	return &downloader{
+		client:    &http.Client{Timeout: downloadTimeout},
+		maxSize:   maxDocumentSize,
+		attempts:  downloadAttempts,
+		baseDelay: downloadBaseDelay,
+		maxDelay:  downloadMaxDelay,
+		sleep:     time.Sleep,
+	}
+}
+
+// download saves the document to the path, size is the expected
+// byte count, 0 if unknown. The file is removed if the download fails.
+func (d *downloader) download(path, url string, size int64) error {
+	var err error
+	for attempt := 1; attempt <= d.attempts; attempt++ {
+		err = d.fetch(path, url, size)
+		if err == nil {
+			return nil
+		}
+
+		_ = os.Remove(path)
+
+		derr, ok := err.(*downloadError)
+		if !ok || !derr.temporary {
+			return err
+		}
+
+		if attempt < d.attempts {
+			d.sleep(d.backoff(attempt))
+		}
+	}
+
+	return err
+}
+
+// backoff doubles the delay with every attempt, half of it is random,
+// so the retries of several workers don't hit the server at once.
+func (d *downloader) backoff(attempt int) time.Duration {
+	delay := d.baseDelay << uint(attempt-1)
+	if delay > d.maxDelay || delay <= 0 {
+		delay = d.maxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (d *downloader) fetch(path, url string, size int64) error {
+	if size > d.maxSize {
+		return errDownloadTooLarge
+	}
+
+	resp, err := d.client.Get(url)
+	if err != nil {
+		if terr, ok := err.(interface{ Timeout() bool }); ok && terr.Timeout() {
+			return &downloadError{reason: "request timed out", temporary: true}
+		}
+		return &downloadError{reason: "request failed", temporary: true}
+	}
+	defer func() {
+		//TODO: error handle
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return &downloadError{
+			reason:    fmt.Sprintf("server responded with %s", resp.Status),
+			temporary: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout,
+		}
+	}
+
+	if resp.ContentLength > d.maxSize {
+		return errDownloadTooLarge
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+
+	n, err := io.Copy(out, io.LimitReader(resp.Body, d.maxSize+1))
+	if err != nil {
+		return &downloadError{reason: "download interrupted", temporary: true}
+	}
+
+	if n > d.maxSize {
+		return errDownloadTooLarge
+	}
+
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return &downloadError{reason: fmt.Sprintf("got %d of %d bytes", n, resp.ContentLength), temporary: true}
+	}
+
+	if size > 0 && n != size {
+		return &downloadError{reason: fmt.Sprintf("got %d bytes, the document has %d", n, size), temporary: true}
+	}
+
+	return out.Sync()
+}
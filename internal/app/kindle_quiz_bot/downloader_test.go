@@ -0,0 +1,150 @@
+package kindle_quiz_bot
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDownloader() *downloader {
+	d := newDownloader()
+	d.maxSize = 16
+	d.sleep = func(time.Duration) {}
+	return d
+}
+
+func TestDownloaderRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("vocab"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "downloader")
+	if err != nil {
+		t.Fatalf("Couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "upload")
+	err = testDownloader().download(path, server.URL, 5)
+	if err != nil {
+		t.Fatalf("Couldn't download: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "vocab" || requests != 3 {
+		t.Fatalf("Invalid download after %d requests: %q, %v", requests, data, err)
+	}
+}
+
+func TestDownloaderFailures(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/not_found":
+			http.NotFound(w, r)
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 32)))
+		case "/unavailable":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte("vocab"))
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "downloader")
+	if err != nil {
+		t.Fatalf("Couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDownloader()
+	cases := []struct {
+		path     string
+		size     int64
+		requests int
+		reason   string
+	}{
+		{"/not_found", 0, 1, "404"},
+		{"/large", 0, 1, errDownloadTooLarge.Error()},
+		{"/unavailable", 0, d.attempts, "502"},
+		{"/short", 10, d.attempts, "got 5 bytes"},
+	}
+
+	for _, c := range cases {
+		requests = 0
+		path := filepath.Join(dir, "upload")
+
+		err := d.download(path, server.URL+c.path, c.size)
+		if err == nil || !strings.Contains(err.Error(), c.reason) {
+			t.Fatalf("Expected %q error for %s, got %v", c.reason, c.path, err)
+		}
+
+		if requests != c.requests {
+			t.Fatalf("Expected %d requests for %s, got %d", c.requests, c.path, requests)
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("Failed download of %s should be removed", c.path)
+		}
+	}
+}
+
+func TestDownloaderErrorHidesURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		_, _ = w.Write([]byte("vocab"))
+	}))
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "downloader")
+	if err != nil {
+		t.Fatalf("Couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const token = "bot123456:SECRET"
+	for _, base := range []string{server.URL, closed.URL} {
+		url := base + "/file/" + token + "/documents/vocab.db"
+
+		err := testDownloader().download(filepath.Join(dir, "upload"), url, 0)
+		if err == nil {
+			t.Fatalf("Expected error for %s", base)
+		}
+
+		if strings.Contains(err.Error(), token) || strings.Contains(err.Error(), base) {
+			t.Fatalf("Error shouldn't have the url: %v", err)
+		}
+	}
+}
+
+func TestDownloaderBackoff(t *testing.T) {
+	d := newDownloader()
+
+	for attempt := 1; attempt < 10; attempt++ {
+		delay := d.backoff(attempt)
+		expected := d.baseDelay << uint(attempt-1)
+		if expected > d.maxDelay {
+			expected = d.maxDelay
+		}
+
+		if delay < expected/2 || delay > expected {
+			t.Fatalf("Delay of attempt %d out of range: %v", attempt, delay)
+		}
+	}
+}
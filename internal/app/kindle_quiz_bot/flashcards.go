@@ -0,0 +1,198 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	cardCallbackPrefix = "card"
+	cardShowAction     = "show"
+)
+
+// cardRating is a self-assessed grade of the flashcard, empty for typed answers.
+type cardRating string
+
+const (
+	noRating    cardRating = ""
+	ratingAgain cardRating = "again"
+	ratingHard  cardRating = "hard"
+	ratingGood  cardRating = "good"
+	ratingEasy  cardRating = "easy"
+)
+
+var cardRatings = []struct {
+	rating cardRating
+	text   string
+}{
+	{ratingAgain, "Again"},
+	{ratingHard, "Hard"},
+	{ratingGood, "Good"},
+	{ratingEasy, "Easy"},
+}
+
+// quality maps the rating to the word scheduling grade.
+func (r cardRating) quality() int {
+	switch r {
+	case ratingEasy:
+		return qualityEasy
+	case ratingGood:
+		return qualityGood
+	case ratingHard:
+		return qualityPassed
+	default:
+		return qualityIncorrect
+	}
+}
+
+// grade maps the rating to the grade of typed answers, so statistics count both.
+func (r cardRating) grade() answerGrade {
+	switch r {
+	case ratingEasy, ratingGood:
+		return gradeCorrect
+	case ratingHard:
+		return gradeAlmostCorrect
+	default:
+		return gradeIncorrect
+	}
+}
+
+// askFlashcard sends the front side of the card with the button revealing the back.
+func (q *quiz) askFlashcard(r guessRequest, l *lang) error {
+	w := r.word
+	front := fmt.Sprintf("Word is: %s; Stem: %s; Lang: %s\n", w.word, w.stem, l.englishName)
+
+	if r.direction == reverseDirection {
+		userLang, err := q.repo.getUserLanguage(r.userId)
+		if err != nil {
+			return err
+		}
+
+		translation, err := q.translateWord(w, userLang)
+		if err != nil {
+			return err
+		}
+
+		front = fmt.Sprintf("Translation is: %s; Lang: %s\n", translation, l.englishName)
+	}
+
+	rows := [][]button{{{text: "Show", data: cardCallbackData(w.id, cardShowAction)}}}
+	return q.sender.SendKeyboard(r.userId, front, rows)
+}
+
+// processCardCallback reveals the back side of the card or records the rating.
+func (q *quiz) processCardCallback(userId int, data string) {
+	wordID, action, err := parseCardCallback(data)
+	if err != nil {
+		log.Printf("card callback: %v: %s", err, data)
+		return
+	}
+
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("card callback: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState != waitingAnswer {
+		q.sendMessage(userId, "The card is already graded. Press /quiz for the next one.")
+		return
+	}
+
+	w, err := q.repo.getLastWord(userId)
+	if err != nil {
+		log.Printf("card callback: %v", err)
+		return
+	}
+
+	direction, kind, err := q.repo.getQuestionType(userId)
+	if err != nil {
+		log.Printf("card callback: %v", err)
+		return
+	}
+
+	if w.id != wordID || kind != flashcardQuestion {
+		q.sendMessage(userId, "The card is already graded. Press /quiz for the next one.")
+		return
+	}
+
+	if action != cardShowAction {
+		q.answerWord(*u, "", cardRating(action))
+		return
+	}
+
+	lang, err := q.repo.getUserLanguage(userId)
+	if err != nil {
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	translation, err := q.translateWord(*w, lang)
+	if err != nil {
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	usage := ""
+	l, err := q.repo.getLookup(userId, w.id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("card callback: %v", err)
+	}
+	if err == nil {
+		usage = l.usage
+	}
+
+	rows := [][]button{make([]button, 0, len(cardRatings))}
+	for _, r := range cardRatings {
+		rows[0] = append(rows[0], button{text: r.text, data: cardCallbackData(w.id, string(r.rating))})
+	}
+
+	err = q.sender.SendKeyboard(userId, cardBack(*w, translation, usage, direction), rows)
+	if err != nil {
+		log.Printf("card callback: %v", err)
+	}
+}
+
+// cardBack is the answer of the card with the sentence the word was looked up in.
+func cardBack(w word, translation, usage string, direction quizDirection) string {
+	r := guessResult{params: guessParams{word: w, direction: direction}, translation: translation}
+	back := fmt.Sprintf("Answer: %s\n", r.answer())
+
+	if usage = strings.TrimSpace(usage); usage != "" {
+		back += fmt.Sprintf("\nContext: %s\n", highlightWord(usage, w.word))
+	}
+
+	return back + "\nHow well did you remember it?"
+}
+
+func cardCallbackData(wordID int, action string) string {
+	return fmt.Sprintf("%s:%d:%s", cardCallbackPrefix, wordID, action)
+}
+
+func parseCardCallback(data string) (wordID int, action string, err error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != cardCallbackPrefix {
+		return 0, "", errInvalidCallback
+	}
+
+	wordID, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, "", errInvalidCallback
+	}
+
+	action = parts[2]
+	if action == cardShowAction {
+		return wordID, action, nil
+	}
+
+	for _, r := range cardRatings {
+		if string(r.rating) == action {
+			return wordID, action, nil
+		}
+	}
+
+	return 0, "", errInvalidCallback
+}
@@ -0,0 +1,48 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestParseCardCallback(t *testing.T) {
+	for _, action := range []string{cardShowAction, string(ratingAgain), string(ratingEasy)} {
+		wordID, parsed, err := parseCardCallback(cardCallbackData(7, action))
+		if err != nil || wordID != 7 || parsed != action {
+			t.Fatalf("Invalid card callback: %d, %s, %v", wordID, parsed, err)
+		}
+	}
+
+	for _, data := range []string{"card:7:perfect", "card:x:show", "choice:7:0", "card:7"} {
+		_, _, err := parseCardCallback(data)
+		if err != errInvalidCallback {
+			t.Fatalf("Callback %q should be rejected", data)
+		}
+	}
+}
+
+func TestCardBack(t *testing.T) {
+	w := word{word: "sperrte", stem: "sperren"}
+
+	back := cardBack(w, "locked", " Er sperrte die Tür ab. ", forwardDirection)
+	if back != "Answer: locked\n\nContext: Er *sperrte* die Tür ab.\n\nHow well did you remember it?" {
+		t.Fatalf("Invalid card back: %q", back)
+	}
+
+	back = cardBack(w, "locked", "", reverseDirection)
+	if back != "Answer: sperrte (sperren)\n\nHow well did you remember it?" {
+		t.Fatalf("Invalid card back: %q", back)
+	}
+}
+
+func TestCardRating(t *testing.T) {
+	p := guessParams{word{word: "Ufer", stem: "Ufer"}, "", 0, forwardDirection, flashcardQuestion, "en", 0, ratingHard}
+	r := guessResult{p, "shore", nil}
+	if r.grade() != gradeAlmostCorrect || r.quality() != qualityPassed {
+		t.Fatalf("Invalid grade of hard card: %v, %d", r.grade(), r.quality())
+	}
+
+	r.params.rating = ratingAgain
+	if r.correct() || r.quality() != qualityIncorrect {
+		t.Fatalf("Card rated again should be incorrect")
+	}
+}
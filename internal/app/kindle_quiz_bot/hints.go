@@ -0,0 +1,135 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxHints is a number of hint steps: the first letter, the length and the usage,
+// translations without the usage are hinted with their first half.
+const maxHints = 3
+
+// ShowHint reveals the answer of the current question step by step,
+// every hint lowers the grade of the answer.
+func (q *quiz) ShowHint(userId int) {
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("show hint: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState != waitingAnswer {
+		q.sendMessage(userId, "No question to hint, press /quiz for the next word")
+		return
+	}
+
+	hints, err := q.repo.getQuestionHints(userId)
+	if err != nil {
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	if hints >= maxHints {
+		q.sendMessage(userId, "No more hints, type the answer or /skip to see it")
+		return
+	}
+
+	w, err := q.repo.getLastWord(userId)
+	if err != nil {
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	direction, _, err := q.repo.getQuestionType(userId)
+	if err != nil {
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	answer := w.word
+	if direction != reverseDirection {
+		lang, err := q.repo.getUserLanguage(userId)
+		if err != nil {
+			q.sendMessage(userId, err.Error())
+			return
+		}
+
+		answer, err = q.translateWord(*w, lang)
+		if err != nil {
+			q.sendMessage(userId, err.Error())
+			return
+		}
+	}
+
+	usage := ""
+	l, err := q.repo.getLookup(userId, w.id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("show hint: %v", err)
+	}
+	if err == nil {
+		usage = l.usage
+	}
+
+	//The hint without the sentence doesn't lower the grade
+	if hints+1 == maxHints && direction == reverseDirection && strings.TrimSpace(usage) == "" {
+		q.sendMessage(userId, "No usage sentence for this word, type the answer or /skip to see it")
+		return
+	}
+
+	hints, err = q.repo.addQuestionHint(userId)
+	if err != nil {
+		q.sendMessage(userId, err.Error())
+		return
+	}
+
+	q.sendMessage(userId, hintText(hints, answer, usage, *w, direction))
+}
+
+// SkipWord reveals the answer, the word is scheduled as not recalled.
+func (q *quiz) SkipWord(userId int) {
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("skip word: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState != waitingAnswer {
+		q.sendMessage(userId, "No question to skip, press /quiz for the next word")
+		return
+	}
+
+	q.guessWord(*u, "")
+}
+
+// hintText is the hint of the given step, the word is masked in the usage sentence
+// like in cloze questions.
+func hintText(step int, answer, usage string, w word, direction quizDirection) string {
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "No hints for this word"
+	}
+	first, _ := utf8.DecodeRuneInString(answer)
+	letters := []rune(answer)
+	n := len(letters)
+
+	switch step {
+	case 1:
+		return fmt.Sprintf("Hint: the answer starts with %q", string(first))
+	case 2:
+		return fmt.Sprintf("Hint: %s%s (%d letters)", string(first), strings.Repeat("_", n-1), n)
+	default:
+		usage = strings.TrimSpace(usage)
+		if usage != "" {
+			return "Hint: " + maskWord(usage, w.word)
+		}
+
+		if direction != reverseDirection {
+			shown := (n + 1) / 2
+			return fmt.Sprintf("Hint: %s%s (%d letters)", string(letters[:shown]), strings.Repeat("_", n-shown), n)
+		}
+		return "No usage sentence for this word, type the answer or /skip to see it"
+	}
+}
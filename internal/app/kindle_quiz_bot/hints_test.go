@@ -0,0 +1,62 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestHintText(t *testing.T) {
+	w := word{word: "sperrte", stem: "sperren"}
+	usage := "Er sperrte die Tür ab."
+
+	cases := []struct {
+		step      int
+		answer    string
+		direction quizDirection
+		expected  string
+	}{
+		{1, "запер", forwardDirection, `Hint: the answer starts with "з"`},
+		{2, "запер", forwardDirection, "Hint: з____ (5 letters)"},
+		{3, "запер", forwardDirection, "Hint: Er ___ die Tür ab."},
+		{3, "sperrte", reverseDirection, "Hint: Er ___ die Tür ab."},
+	}
+
+	for _, c := range cases {
+		hint := hintText(c.step, c.answer, usage, w, c.direction)
+		if hint != c.expected {
+			t.Fatalf("Expected %q, got %q", c.expected, hint)
+		}
+	}
+
+	hint := hintText(3, "запер", "", w, forwardDirection)
+	if hint != "Hint: зап__ (5 letters)" {
+		t.Fatalf("Translation without usage should be hinted with its half: %q", hint)
+	}
+}
+
+func TestHintsLowerGrade(t *testing.T) {
+	p := guessParams{word{word: "Ufer", stem: "Ufer"}, "shore", 0, forwardDirection, translationQuestion, "en", 0, noRating}
+	r := guessResult{p, "shore", nil}
+	if r.grade() != gradeCorrect || r.quality() != qualityGood || !r.recalled() {
+		t.Fatalf("Answer without hints should keep the streak: %v, %d", r.grade(), r.quality())
+	}
+
+	r.params.hints = 1
+	if r.grade() != gradeAlmostCorrect || r.quality() != qualityPassed || r.recalled() {
+		t.Fatalf("Hint should lower the grade: %v, %d", r.grade(), r.quality())
+	}
+
+	r.params.hints = 2
+	if r.grade() != gradeAlmostCorrect || r.quality() != qualityPassed-1 || !r.correct() {
+		t.Fatalf("Every hint should lower the quality of correct answer: %v, %d", r.grade(), r.quality())
+	}
+
+	r.params.hints = 3
+	if r.quality() != qualityIncorrect {
+		t.Fatalf("Answer after all hints should be scheduled like a lapse: %d", r.quality())
+	}
+
+	r.params.guess = " "
+	if !r.skipped() || r.quality() != qualityBlackout {
+		t.Fatalf("Skipped word should be scheduled as blackout")
+	}
+}
@@ -0,0 +1,77 @@
+package kindle_quiz_bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const shortHashLength = 8
+
+func (q *quiz) ShowImports(userId int) {
+	batches, err := q.repo.getImportBatches(userId)
+	if err != nil {
+		log.Printf("show imports: %v", err)
+		q.sendMessage(userId, "Couldn't load your imports")
+		return
+	}
+
+	if len(batches) == 0 {
+		q.sendMessage(userId, "No imports found. Please run /upload and follow instructions")
+		return
+	}
+
+	msg := "Your imports:\n\n"
+	for _, b := range batches {
+		hash := b.fileHash
+		if len(hash) > shortHashLength {
+			hash = hash[:shortHashLength]
+		}
+		msg += fmt.Sprintf("#%d %s: %d words, %d lookups, file %s\n",
+			b.id, b.createdAt.Format("2006-01-02 15:04"), b.wordsCount, b.lookupsCount, hash)
+	}
+	msg += "\nRun /undo_import <id> to remove words introduced by the import"
+
+	q.sendMessage(userId, msg)
+}
+
+func (q *quiz) UndoImport(userId int, arg string) {
+	batchID, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(arg), "#"))
+	if err != nil {
+		q.sendMessage(userId, "Usage: /undo_import <id>, where id is a number from /imports")
+		return
+	}
+
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("undo import: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState == migrationInProgress {
+		q.showMigrationInProgressWarn(userId)
+		return
+	}
+
+	err = q.repo.undoImportBatch(userId, batchID)
+	if err == errBatchNotFound {
+		q.sendMessage(userId, "Import not found, see /imports")
+		return
+	}
+	if err != nil {
+		log.Printf("undo import: %v", err)
+		q.sendMessage(userId, "Couldn't undo the import")
+		return
+	}
+
+	if u.currentState == waitingAnswer {
+		//Asked word might be removed
+		err = q.repo.updateUserState(userId, readyForQuestion)
+		if err != nil {
+			log.Printf("undo import: %v", err)
+		}
+	}
+
+	q.sendMessage(userId, fmt.Sprintf("Import #%d removed", batchID))
+}
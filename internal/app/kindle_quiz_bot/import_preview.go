@@ -0,0 +1,198 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const previewBooksCount = 3
+
+// importPreview summarises the vocabulary before it's written to postgres.
+type importPreview struct {
+	totalWords  int
+	newWords    int
+	knownWords  int
+	languages   map[string]int
+	topBooks    []bookLookups
+	firstLookup time.Time
+	lastLookup  time.Time
+}
+
+type bookLookups struct {
+	title   string
+	lookups int
+}
+
+func wordKey(w, stem, lc string) string {
+	return w + "\x00" + stem + "\x00" + normalizeLangCode(lc)
+}
+
+// showPreview analyses the uploaded file
+// and waits for user to confirm the import.
+func (q *quiz) showPreview(userId int, path string, profiles []string) error {
+	v, total, err := readUpload(path, userId, q.repo, profiles)
+	if err != nil {
+		return err
+	}
+
+	known, err := q.repo.getUserWordKeys(userId)
+	if err != nil {
+		return err
+	}
+
+	err = q.keepPendingUpload(userId, pendingUpload{path: path, profiles: profiles})
+	if err != nil {
+		return err
+	}
+
+	err = q.repo.updateUserState(userId, awaitingConfirmation)
+	if err != nil {
+		return err
+	}
+
+	p := previewVocabulary(*v, known, total)
+	q.sendMessage(userId, formatPreview(p))
+
+	return nil
+}
+
+func (q *quiz) ConfirmImport(userId int) {
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("confirm import: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState != awaitingConfirmation {
+		q.sendMessage(userId, "Nothing to confirm. Run /upload to import your vocab.db")
+		return
+	}
+
+	upload, err := q.repo.getPendingUpload(userId)
+	if err == sql.ErrNoRows {
+		q.sendMessage(userId, "Upload expired, please run /upload again")
+		_ = q.repo.updateUserState(userId, readyForQuestion)
+		return
+	}
+	if err != nil {
+		log.Printf("confirm import: %v", err)
+		return //TODO: error handle
+	}
+
+	err = q.repo.deletePendingUpload(userId)
+	if err != nil {
+		log.Printf("confirm import: %v", err)
+	}
+
+	err = q.repo.updateUserState(userId, migrationInProgress)
+	if err != nil {
+		log.Printf("confirm import: %v", err)
+	}
+
+	q.enqueueMigration(migrationJob{
+		downloadJob:  downloadJob{userId: userId},
+		documentPath: upload.path,
+		profiles:     upload.profiles,
+		confirmed:    true,
+	})
+}
+
+func previewVocabulary(v vocabulary, known map[string]bool, total int) importPreview {
+	p := importPreview{totalWords: total, languages: make(map[string]int)}
+
+	seen := make(map[string]bool, len(v.words))
+	for _, w := range v.words {
+		key := wordKey(w.word, w.stem, w.lc)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if known[key] {
+			p.knownWords++
+		} else {
+			p.newWords++
+		}
+		p.languages[normalizeLangCode(w.lc)]++
+	}
+
+	titles := make(map[string]string, len(v.books))
+	for _, b := range v.books {
+		titles[b.key] = b.title
+	}
+
+	counts := make(map[string]int)
+	for _, l := range v.lookups {
+		counts[l.bookKey]++
+
+		if l.timestamp == 0 {
+			continue
+		}
+
+		t := time.Unix(0, l.timestamp*int64(time.Millisecond))
+		if p.firstLookup.IsZero() || t.Before(p.firstLookup) {
+			p.firstLookup = t
+		}
+		if t.After(p.lastLookup) {
+			p.lastLookup = t
+		}
+	}
+
+	for key, count := range counts {
+		title := titles[key]
+		if title == "" {
+			title = "Unknown book"
+		}
+		p.topBooks = append(p.topBooks, bookLookups{title, count})
+	}
+
+	sort.Slice(p.topBooks, func(i, j int) bool {
+		if p.topBooks[i].lookups == p.topBooks[j].lookups {
+			return p.topBooks[i].title < p.topBooks[j].title
+		}
+		return p.topBooks[i].lookups > p.topBooks[j].lookups
+	})
+
+	if len(p.topBooks) > previewBooksCount {
+		p.topBooks = p.topBooks[:previewBooksCount]
+	}
+
+	return p
+}
+
+func formatPreview(p importPreview) string {
+	msg := "Import preview:\n\n"
+	msg += fmt.Sprintf("Total words: %d\n", p.totalWords)
+	msg += fmt.Sprintf("New words: %d, already known: %d\n", p.newWords, p.knownWords)
+
+	if len(p.languages) > 0 {
+		codes := make([]string, 0, len(p.languages))
+		for lc := range p.languages {
+			codes = append(codes, lc)
+		}
+		sort.Strings(codes)
+
+		msg += "Languages:"
+		for _, lc := range codes {
+			msg += fmt.Sprintf(" %s (%d)", lc, p.languages[lc])
+		}
+		msg += "\n"
+	}
+
+	if len(p.topBooks) > 0 {
+		msg += "Top books:\n"
+		for i, b := range p.topBooks {
+			msg += fmt.Sprintf("%d. %s: %d lookups\n", i+1, b.title, b.lookups)
+		}
+	}
+
+	if !p.firstLookup.IsZero() {
+		msg += fmt.Sprintf("Lookups from %s to %s\n", p.firstLookup.Format("2006-01-02"), p.lastLookup.Format("2006-01-02"))
+	}
+
+	msg += "\nSend /confirm to import or /cancel to discard the upload."
+	return msg
+}
@@ -0,0 +1,39 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestPreviewVocabulary(t *testing.T) {
+	known := vocabWord{word: "sogar", stem: "sogar", lc: "de"}
+	fresh := vocabWord{word: "sperrte", stem: "Sperre", lc: "de"}
+	english := vocabWord{word: "eldritch", stem: "eldritch", lc: "en"}
+
+	v := vocabulary{
+		words: []vocabWord{known, fresh, fresh, english},
+		lookups: []vocabLookup{
+			{word: fresh, bookKey: "ruf", timestamp: 1525719074506},
+			{word: known, bookKey: "ruf", timestamp: 1525719121268},
+			{word: english, bookKey: "lovecraft", timestamp: 1463322429074},
+		},
+		books: []book{{key: "ruf", title: "Der Ruf der Tagesfische"}, {key: "lovecraft", title: "Lovecraft"}},
+	}
+
+	p := previewVocabulary(v, map[string]bool{wordKey("sogar", "sogar", "DE"): true}, 10)
+
+	if p.totalWords != 10 || p.newWords != 2 || p.knownWords != 1 {
+		t.Fatalf("Invalid counts: total %d, new %d, known %d", p.totalWords, p.newWords, p.knownWords)
+	}
+
+	if p.languages["de"] != 2 || p.languages["en"] != 1 {
+		t.Fatalf("Invalid languages: %v", p.languages)
+	}
+
+	if len(p.topBooks) != 2 || p.topBooks[0].title != "Der Ruf der Tagesfische" || p.topBooks[0].lookups != 2 {
+		t.Fatalf("Invalid top books: %v", p.topBooks)
+	}
+
+	if p.firstLookup.Year() != 2016 || p.lastLookup.Year() != 2018 {
+		t.Fatalf("Invalid lookups range: %v - %v", p.firstLookup, p.lastLookup)
+	}
+}
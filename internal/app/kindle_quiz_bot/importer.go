@@ -0,0 +1,86 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// vocabImporter reads e-reader vocabulary database for the bulk import,
+// rows are read incrementally with user's import progress of the profile.
+type vocabImporter interface {
+	// detect reports whether the database is of importer's format.
+	detect(db *sql.DB) (bool, error)
+	// validate checks the tables and columns importer reads,
+	// validationError is returned if the database is rejected.
+	validate(db *sql.DB) error
+	profiles(db *sql.DB) ([]deviceProfile, error)
+	books(db *sql.DB) ([]book, error)
+	words(db *sql.DB, p importProgress) ([]vocabWord, error)
+	lookups(db *sql.DB, p importProgress) ([]vocabLookup, error)
+}
+
+var vocabImporters = []vocabImporter{
+	kindleImporter{},
+	koboImporter{},
+	koreaderImporter{},
+}
+
+// detectImporter returns importer of the database format,
+// validationError is returned for unknown and corrupted databases.
+func detectImporter(db *sql.DB) (vocabImporter, error) {
+	for _, imp := range vocabImporters {
+		ok, err := imp.detect(db)
+		if err != nil {
+			if strings.Contains(err.Error(), "malformed") || strings.Contains(err.Error(), "not a database") {
+				return nil, invalidFile("The database is corrupted. Copy the file from your device again.")
+			}
+			return nil, err
+		}
+
+		if ok {
+			return imp, nil
+		}
+	}
+
+	return nil, invalidFile("The database has no vocabulary. Send vocab.db from Kindle, KoboReader.sqlite from Kobo or vocabulary_builder.sqlite3 from KOReader.")
+}
+
+// hasTable reports whether the sqlite database has the table.
+func hasTable(db *sql.DB, table string) (bool, error) {
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return false, err
+	}
+	return len(columns) > 0, nil
+}
+
+// kindleImporter reads Kindle vocab.db, words are grouped by device profiles.
+type kindleImporter struct{}
+
+func (kindleImporter) detect(db *sql.DB) (bool, error) {
+	ok, err := hasTable(db, "WORDS")
+	if err != nil || ok {
+		return ok, err
+	}
+	return hasTable(db, "VERSION")
+}
+
+func (kindleImporter) validate(db *sql.DB) error {
+	return checkKindleSchema(db)
+}
+
+func (kindleImporter) profiles(db *sql.DB) ([]deviceProfile, error) {
+	return kindleProfiles(db)
+}
+
+func (kindleImporter) books(db *sql.DB) ([]book, error) {
+	return readKindleBooks(db)
+}
+
+func (kindleImporter) words(db *sql.DB, p importProgress) ([]vocabWord, error) {
+	return readKindleWords(db, p)
+}
+
+func (kindleImporter) lookups(db *sql.DB, p importProgress) ([]vocabLookup, error) {
+	return readKindleLookups(db, p)
+}
@@ -0,0 +1,104 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestDetectImporter(t *testing.T) {
+	cases := []struct {
+		path     string
+		importer vocabImporter
+	}{
+		{"../../../test/data/vocab.db", kindleImporter{}},
+		{"../../../test/data/KoboReader.sqlite", koboImporter{}},
+		{"../../../test/data/vocabulary_builder.sqlite3", koreaderImporter{}},
+	}
+
+	for _, c := range cases {
+		db, err := openVocabDB(c.path)
+		if err != nil {
+			t.Fatalf("Couldn't open %s: %v", c.path, err)
+		}
+
+		imp, err := detectImporter(db)
+		_ = db.Close()
+		if err != nil {
+			t.Fatalf("Couldn't detect importer of %s: %v", c.path, err)
+		}
+
+		if imp != c.importer {
+			t.Fatalf("Invalid importer of %s: %T", c.path, imp)
+		}
+	}
+}
+
+func TestKoboImporter(t *testing.T) {
+	db, err := openVocabDB("../../../test/data/KoboReader.sqlite")
+	if err != nil {
+		t.Fatalf("Couldn't open db: %v", err)
+	}
+	defer db.Close()
+
+	imp := koboImporter{}
+
+	books, err := imp.books(db)
+	if err != nil {
+		t.Fatalf("Couldn't read books: %v", err)
+	}
+
+	if len(books) != 2 {
+		t.Fatalf("Only books with words expected, got %v", books)
+	}
+
+	lookups, err := imp.lookups(db, importProgress{profileID: koboProfile})
+	if err != nil {
+		t.Fatalf("Couldn't read lookups: %v", err)
+	}
+
+	langs := make(map[string]string)
+	for _, l := range lookups {
+		langs[l.word.word] = l.word.lc
+	}
+
+	if len(lookups) != 5 || langs["Ungeziefer"] != "de" || langs["Bettdecke"] != "de" || langs["eldritch"] != "en" {
+		t.Fatalf("Invalid words languages: %v", langs)
+	}
+
+	words, err := imp.words(db, importProgress{profileID: koboProfile, wordTimestamp: parseKoboDate("2020-02-10T08:05:31Z")})
+	if err != nil {
+		t.Fatalf("Couldn't read words: %v", err)
+	}
+
+	if len(words) != 1 || words[0].word != "cyclopean" {
+		t.Fatalf("Only words newer than progress expected, got %v", words)
+	}
+}
+
+func TestKOReaderImporter(t *testing.T) {
+	db, err := openVocabDB("../../../test/data/vocabulary_builder.sqlite3")
+	if err != nil {
+		t.Fatalf("Couldn't open db: %v", err)
+	}
+	defer db.Close()
+
+	imp := koreaderImporter{}
+
+	lookups, err := imp.lookups(db, importProgress{profileID: koreaderProfile, lookupTimestamp: 1525719074000})
+	if err != nil {
+		t.Fatalf("Couldn't read lookups: %v", err)
+	}
+
+	if len(lookups) != 3 {
+		t.Fatalf("Only lookups newer than progress expected, got %v", lookups)
+	}
+
+	for _, l := range lookups {
+		if l.word.word == "Feigenbaum" && (l.usage != "Im Schatten des Feigenbaums wuchs Siddhartha auf." || l.bookKey != koreaderBookKey(2)) {
+			t.Fatalf("Invalid lookup: %+v", l)
+		}
+
+		if l.word.word == "Ufer" && (l.usage != "" || l.bookKey != "") {
+			t.Fatalf("Lookup without context and book expected: %+v", l)
+		}
+	}
+}
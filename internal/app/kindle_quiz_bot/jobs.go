@@ -0,0 +1,159 @@
+package kindle_quiz_bot
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+type jobKind string
+
+const (
+	downloadJobKind jobKind = "download"
+	importJobKind   jobKind = "import"
+)
+
+type jobStatus string
+
+const (
+	jobQueued      jobStatus = "queued"
+	jobDownloading jobStatus = "downloading"
+	jobImporting   jobStatus = "importing"
+	jobDone        jobStatus = "done"
+	jobFailed      jobStatus = "failed"
+)
+
+const (
+	// maxJobAttempts limits resuming of the jobs interrupted by restarts.
+	maxJobAttempts = 3
+	// jobsPollInterval is how often workers look for jobs queued by other processes.
+	jobsPollInterval = 10 * time.Second
+)
+
+// interruptedJob is a job which was running when the process stopped.
+type interruptedJob struct {
+	id        int
+	userId    int
+	kind      jobKind
+	path      string
+	confirmed bool
+	attempts  int
+}
+
+func (q *quiz) enqueueDownload(j downloadJob) {
+	err := q.repo.addDownloadJob(j)
+	if err != nil {
+		log.Printf("enqueue download: %v", err)
+		q.sendMessage(j.userId, "Document couldn't be downloaded, please send it again")
+		return
+	}
+
+	notifyWorkers(q.downloadJobs)
+}
+
+func (q *quiz) enqueueMigration(j migrationJob) {
+	err := q.repo.addMigrationJob(j)
+	if err != nil {
+		log.Printf("enqueue migration: %v", err)
+		q.sendMessage(j.userId, "Couldn't process the file, please /upload it again")
+		_ = q.repo.updateUserState(j.userId, readyForQuestion)
+		return
+	}
+
+	notifyWorkers(q.migrationJobs)
+}
+
+// notifyWorkers wakes a sleeping worker, the job is claimed
+// on next poll if all of them are busy.
+func notifyWorkers(queued chan struct{}) {
+	select {
+	case queued <- struct{}{}:
+	default:
+	}
+}
+
+// waitForJobs blocks until a job is queued or poll interval passes,
+// false is returned when the quiz is closed.
+func (q *quiz) waitForJobs(queued <-chan struct{}) bool {
+	select {
+	case <-q.stop:
+		return false
+	case <-queued:
+		return true
+	case <-time.After(jobsPollInterval):
+		return true
+	}
+}
+
+func (q *quiz) finishJob(id int, err error) {
+	status, msg := jobDone, ""
+	if err != nil {
+		status, msg = jobFailed, err.Error()
+	}
+
+	err = q.repo.finishJob(id, status, msg)
+	if err != nil {
+		log.Printf("finish job %d: %v", id, err)
+	}
+}
+
+// recoverJobs resumes the jobs interrupted by the restart, jobs
+// which were interrupted too many times or lost their files are failed.
+// Only one bot process is expected to run, so every running job is interrupted.
+func (q *quiz) recoverJobs() {
+	jobs, err := q.repo.getInterruptedJobs()
+	if err != nil {
+		log.Printf("recover jobs: %v", err)
+		return
+	}
+
+	for _, j := range jobs {
+		resumable := j.attempts < maxJobAttempts
+		if j.kind == importJobKind {
+			_, err := os.Stat(j.path)
+			resumable = resumable && err == nil
+		}
+
+		if !resumable {
+			q.failInterruptedJob(j)
+			continue
+		}
+
+		err := q.repo.requeueJob(j.id)
+		if err != nil {
+			log.Printf("recover job %d: %v", j.id, err)
+			continue
+		}
+
+		switch {
+		case j.kind == downloadJobKind:
+			q.sendMessage(j.userId, "The bot was restarted while downloading your file, downloading it again...")
+		case j.confirmed:
+			q.sendMessage(j.userId, "The bot was restarted while importing your file, importing it again...")
+		default:
+			q.sendMessage(j.userId, "The bot was restarted while processing your file, processing it again...")
+		}
+	}
+}
+
+func (q *quiz) failInterruptedJob(j interruptedJob) {
+	err := q.repo.finishJob(j.id, jobFailed, "interrupted by restart")
+	if err != nil {
+		log.Printf("recover job %d: %v", j.id, err)
+		return
+	}
+
+	if j.path != "" {
+		_ = removeUpload(j.path)
+	}
+
+	u, err := q.repo.getUser(j.userId)
+	if err == nil && u.currentState == migrationInProgress {
+		err = q.repo.updateUserState(j.userId, readyForQuestion)
+	}
+	if err != nil {
+		log.Printf("recover job %d: %v", j.id, err)
+	}
+
+	q.sendMessage(j.userId, "The bot was restarted while processing your file and couldn't resume it. Please /upload the file again.")
+}
@@ -0,0 +1,189 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// koboProfile is the only profile of Kobo database,
+// it keeps Kobo import progress apart from Kindle profiles.
+const koboProfile = "kobo"
+
+// koboBookContentType is content.ContentType of books, chapters have other types.
+const koboBookContentType = 6
+
+var koboTables = []schemaTable{
+	{"WordList", []string{"Text", "VolumeId", "DictSuffix", "DateCreated"}},
+	{"content", []string{"ContentID", "ContentType", "Title", "Attribution", "Language"}},
+}
+
+var koboDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// koboImporter reads KoboReader.sqlite, Kobo keeps looked up words
+// without stems and usage sentences.
+type koboImporter struct{}
+
+func (koboImporter) detect(db *sql.DB) (bool, error) {
+	return hasTable(db, "WordList")
+}
+
+func (koboImporter) validate(db *sql.DB) error {
+	return checkTables(db, koboTables, "Kobo KoboReader.sqlite")
+}
+
+func (koboImporter) profiles(db *sql.DB) ([]deviceProfile, error) {
+	p := deviceProfile{id: koboProfile}
+	err := db.QueryRow("SELECT COUNT(*) FROM WordList").Scan(&p.wordsCount)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: counting kobo words: %v", err.Error())
+	}
+
+	if p.wordsCount == 0 {
+		return []deviceProfile{}, nil
+	}
+	return []deviceProfile{p}, nil
+}
+
+// books reads only the books words were looked up in, Kobo content
+// table has the whole library along with book chapters.
+func (koboImporter) books(db *sql.DB) ([]book, error) {
+	rows, err := db.Query(`
+		SELECT ContentID, Title, Attribution, Language 
+		FROM content 
+		WHERE ContentType = ? AND ContentID IN (SELECT VolumeId FROM WordList)`, koboBookContentType)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying kobo books: %v", err.Error())
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			//TODO: error handle
+			fmt.Printf("sqlite rows close: %v", err)
+		}
+	}()
+
+	books := make([]book, 0)
+
+	for rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var title, authors, lc sql.NullString
+		b := book{}
+		err = rows.Scan(&b.key, &title, &authors, &lc)
+		if err != nil {
+			return nil, fmt.Errorf("migration: scan kobo book: %v", err.Error())
+		}
+
+		b.title = title.String
+		b.authors = authors.String
+		b.lang = koboLangCode(lc.String)
+
+		books = append(books, b)
+	}
+
+	return books, nil
+}
+
+func (imp koboImporter) words(db *sql.DB, p importProgress) ([]vocabWord, error) {
+	lookups, err := imp.lookups(db, importProgress{profileID: p.profileID, lookupTimestamp: p.wordTimestamp})
+	if err != nil {
+		return nil, err
+	}
+
+	words := make([]vocabWord, 0, len(lookups))
+	for _, l := range lookups {
+		words = append(words, l.word)
+	}
+
+	return words, nil
+}
+
+// lookups links Kobo words to their books, the lookups have no usage.
+func (koboImporter) lookups(db *sql.DB, p importProgress) ([]vocabLookup, error) {
+	rows, err := db.Query(`
+		SELECT w.Text, w.VolumeId, w.DictSuffix, w.DateCreated, COALESCE(c.Language, '') 
+		FROM WordList w 
+		LEFT JOIN content c ON c.ContentID = w.VolumeId AND c.ContentType = ?`, koboBookContentType)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying kobo words: %v", err.Error())
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			//TODO: error handle
+			fmt.Printf("sqlite rows close: %v", err)
+		}
+	}()
+
+	lookups := make([]vocabLookup, 0)
+
+	for rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var dictSuffix, created sql.NullString
+		var text, bookLang string
+		l := vocabLookup{}
+		err = rows.Scan(&text, &l.bookKey, &dictSuffix, &created, &bookLang)
+		if err != nil {
+			return nil, fmt.Errorf("migration: scan kobo word: %v", err.Error())
+		}
+
+		//Dates are strings, so newer rows are filtered after parsing,
+		//rows without date are read every time, import skips duplicates
+		l.timestamp = parseKoboDate(created.String)
+		if l.timestamp != 0 && l.timestamp <= p.lookupTimestamp {
+			continue
+		}
+
+		text = strings.TrimSpace(text)
+		l.word = vocabWord{word: text, stem: text, lc: koboWordLang(dictSuffix.String, bookLang), timestamp: l.timestamp}
+
+		lookups = append(lookups, l)
+	}
+
+	return lookups, nil
+}
+
+// koboWordLang takes the language from the dictionary used for the lookup,
+// e.g. "-de", the default dictionary has no suffix, so the book language is used.
+func koboWordLang(dictSuffix, bookLang string) string {
+	lc := strings.TrimPrefix(strings.TrimSpace(dictSuffix), "-")
+	if lc != "" {
+		return strings.ToLower(lc)
+	}
+	return koboLangCode(bookLang)
+}
+
+// koboLangCode turns book language like "en-US" into language code.
+func koboLangCode(lc string) string {
+	lc = strings.TrimSpace(lc)
+	if i := strings.IndexAny(lc, "-_"); i >= 0 {
+		lc = lc[:i]
+	}
+	return strings.ToLower(lc)
+}
+
+// parseKoboDate returns milliseconds like Kindle timestamps,
+// 0 for unknown date formats.
+func parseKoboDate(s string) int64 {
+	for _, layout := range koboDateLayouts {
+		t, err := time.Parse(layout, strings.TrimSpace(s))
+		if err == nil {
+			return t.UnixNano() / int64(time.Millisecond)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// koreaderProfile is the only profile of KOReader vocabulary builder database.
+const koreaderProfile = "koreader"
+
+var koreaderTables = []schemaTable{
+	{"vocabulary", []string{"word", "title_id", "create_time", "prev_context", "next_context"}},
+	{"title", []string{"id", "name"}},
+}
+
+// koreaderImporter reads KOReader vocabulary_builder.sqlite3, words
+// have no language, user's source language is used for them.
+type koreaderImporter struct{}
+
+func (koreaderImporter) detect(db *sql.DB) (bool, error) {
+	return hasTable(db, "vocabulary")
+}
+
+func (koreaderImporter) validate(db *sql.DB) error {
+	return checkTables(db, koreaderTables, "KOReader vocabulary_builder.sqlite3")
+}
+
+func (koreaderImporter) profiles(db *sql.DB) ([]deviceProfile, error) {
+	p := deviceProfile{id: koreaderProfile}
+	err := db.QueryRow("SELECT COUNT(*) FROM vocabulary").Scan(&p.wordsCount)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: counting koreader words: %v", err.Error())
+	}
+
+	if p.wordsCount == 0 {
+		return []deviceProfile{}, nil
+	}
+	return []deviceProfile{p}, nil
+}
+
+func (koreaderImporter) books(db *sql.DB) ([]book, error) {
+	rows, err := db.Query("SELECT id, name FROM title")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying koreader books: %v", err.Error())
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			//TODO: error handle
+			fmt.Printf("sqlite rows close: %v", err)
+		}
+	}()
+
+	books := make([]book, 0)
+
+	for rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var id int
+		var name sql.NullString
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return nil, fmt.Errorf("migration: scan koreader book: %v", err.Error())
+		}
+
+		books = append(books, book{key: koreaderBookKey(id), title: name.String})
+	}
+
+	return books, nil
+}
+
+func (imp koreaderImporter) words(db *sql.DB, p importProgress) ([]vocabWord, error) {
+	lookups, err := imp.lookups(db, importProgress{profileID: p.profileID, lookupTimestamp: p.wordTimestamp})
+	if err != nil {
+		return nil, err
+	}
+
+	words := make([]vocabWord, 0, len(lookups))
+	for _, l := range lookups {
+		words = append(words, l.word)
+	}
+
+	return words, nil
+}
+
+// lookups reads the words with the sentences around them, KOReader
+// keeps the word once, so every word has one lookup.
+func (koreaderImporter) lookups(db *sql.DB, p importProgress) ([]vocabLookup, error) {
+	rows, err := db.Query(`
+		SELECT word, title_id, create_time, COALESCE(prev_context, ''), COALESCE(next_context, '') 
+		FROM vocabulary 
+		WHERE create_time * 1000 > ?`, p.lookupTimestamp)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: querying koreader words: %v", err.Error())
+	}
+	defer func() {
+		err = rows.Close()
+		if err != nil {
+			//TODO: error handle
+			fmt.Printf("sqlite rows close: %v", err)
+		}
+	}()
+
+	lookups := make([]vocabLookup, 0)
+
+	for rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var text, prev, next string
+		var titleID sql.NullInt64
+		var created int64
+		err = rows.Scan(&text, &titleID, &created, &prev, &next)
+		if err != nil {
+			return nil, fmt.Errorf("migration: scan koreader word: %v", err.Error())
+		}
+
+		text = strings.TrimSpace(text)
+
+		l := vocabLookup{
+			word:      vocabWord{word: text, stem: text, timestamp: created * 1000},
+			timestamp: created * 1000,
+		}
+		if strings.TrimSpace(prev+next) != "" {
+			l.usage = strings.TrimSpace(prev + text + next)
+		}
+		if titleID.Valid {
+			l.bookKey = koreaderBookKey(int(titleID.Int64))
+		}
+
+		lookups = append(lookups, l)
+	}
+
+	return lookups, nil
+}
+
+// koreaderBookKey keeps KOReader title ids apart from other devices book keys.
+func koreaderBookKey(titleID int) string {
+	return koreaderProfile + ":" + strconv.Itoa(titleID)
+}
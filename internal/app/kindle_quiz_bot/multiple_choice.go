@@ -0,0 +1,278 @@
+package kindle_quiz_bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	choiceOptionsCount   = 4
+	choiceCallbackPrefix = "choice"
+)
+
+var errInvalidCallback = errors.New("invalid callback data")
+
+type quizMode int
+
+const (
+	typingMode quizMode = iota
+	choiceMode
+	clozeMode
+	flashcardMode
+)
+
+var quizModes = []struct {
+	mode        quizMode
+	name        string
+	description string
+}{
+	{typingMode, "typing", "type the translation"},
+	{choiceMode, "choice", "choose the translation from 4 options"},
+	{clozeMode, "cloze", "fill in the word missing in the sentence from your book"},
+	{flashcardMode, "flashcards", "recall the answer, reveal it and grade yourself"},
+}
+
+// button is an inline keyboard button, data comes back with the callback.
+type button struct {
+	text string
+	data string
+}
+
+func (q *quiz) SelectMode(userId int, arg string) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+
+	for _, m := range quizModes {
+		if m.name != arg {
+			continue
+		}
+
+		err := q.repo.setQuizMode(userId, m.mode)
+		if err != nil {
+			log.Printf("select mode: %v", err)
+			return //TODO: error handle
+		}
+
+		q.sendMessage(userId, fmt.Sprintf("Quiz mode: %s. Press /quiz to start.", m.name))
+		return
+	}
+
+	msg := "Quiz modes:\n\n"
+	for _, m := range quizModes {
+		msg += fmt.Sprintf("%s - %s\n", m.name, m.description)
+	}
+	msg += "\nRun /mode <name> to switch."
+	q.sendMessage(userId, msg)
+}
+
+// askChoice sends the question with translation options as keyboard buttons,
+// false is returned if user has too few words for the options.
+func (q *quiz) askChoice(r guessRequest, question string) (bool, error) {
+	lang, err := q.repo.getUserLanguage(r.userId)
+	if err != nil {
+		return false, err
+	}
+
+	//Some distractors may have the same translation
+	words, err := q.repo.getDistractors(r.userId, r.word, (choiceOptionsCount-1)*2)
+	if err != nil {
+		return false, err
+	}
+
+	//Reverse questions are answered with the words themselves
+	correct := r.word.word
+	distractors := make([]string, 0, len(words))
+	for _, w := range words {
+		distractors = append(distractors, w.word)
+	}
+
+	if r.direction != reverseDirection {
+		correct, err = q.translateWord(r.word, lang)
+		if err != nil {
+			return false, err
+		}
+
+		distractors, err = q.distractorTranslations(correct, words, lang)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	options, ok := choiceOptions(correct, distractors, choiceOptionsCount)
+	if !ok {
+		return false, nil
+	}
+
+	err = q.repo.setQuestionOptions(r.userId, options)
+	if err != nil {
+		return false, err
+	}
+
+	rows := make([][]button, 0, len(options))
+	for i, o := range options {
+		rows = append(rows, []button{{text: o, data: choiceCallbackData(r.word.id, i)}})
+	}
+
+	err = q.sender.SendKeyboard(r.userId, question, rows)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// distractorTranslations returns cached translations of the words, the rest
+// is translated by the backend until there are enough options.
+func (q *quiz) distractorTranslations(correct string, words []word, dst *lang) ([]string, error) {
+	ids := make([]int, 0, len(words))
+	for _, w := range words {
+		ids = append(ids, w.id)
+	}
+
+	cached, err := q.repo.getCachedTranslations(ids, dst.id)
+	if err != nil {
+		return nil, err
+	}
+
+	return fillDistractors(correct, words, cached, func(w word) (string, error) {
+		return q.translateWord(w, dst)
+	}), nil
+}
+
+// fillDistractors takes cached translations of the words and translates
+// the uncached ones until there are enough distinct options or no words left.
+func fillDistractors(correct string, words []word, cached map[int]string, translate func(word) (string, error)) []string {
+	translations := make([]string, 0, len(words))
+	uncached := make([]word, 0, len(words))
+	for _, w := range words {
+		if t, ok := cached[w.id]; ok {
+			translations = append(translations, t)
+		} else {
+			uncached = append(uncached, w)
+		}
+	}
+
+	for _, w := range uncached {
+		if _, ok := choiceOptions(correct, translations, choiceOptionsCount); ok {
+			break
+		}
+
+		translated, err := translate(w)
+		if err != nil {
+			log.Printf("distractor translation: %v", err)
+			continue
+		}
+		translations = append(translations, translated)
+	}
+
+	return translations
+}
+
+// ProcessCallback handles pressed keyboard buttons.
+func (q *quiz) ProcessCallback(userId int, data string) {
+	if strings.HasPrefix(data, disputeCallbackPrefix+":") {
+		q.reviewDispute(userId, data)
+		return
+	}
+
+	if strings.HasPrefix(data, cardCallbackPrefix+":") {
+		q.processCardCallback(userId, data)
+		return
+	}
+
+	wordID, index, err := parseChoiceCallback(data)
+	if err != nil {
+		log.Printf("process callback: %v: %s", err, data)
+		return
+	}
+
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("process callback: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState != waitingAnswer {
+		q.sendMessage(userId, "The question is already answered. Press /quiz for the next one.")
+		return
+	}
+
+	w, err := q.repo.getLastWord(userId)
+	if err != nil {
+		log.Printf("process callback: %v", err)
+		return
+	}
+
+	options, err := q.repo.getQuestionOptions(userId)
+	if err != nil {
+		log.Printf("process callback: %v", err)
+		return
+	}
+
+	if w.id != wordID || index >= len(options) {
+		q.sendMessage(userId, "The question is already answered. Press /quiz for the next one.")
+		return
+	}
+
+	q.guessWord(*u, options[index])
+}
+
+// choiceOptions returns shuffled options with the correct one and
+// distinct distractors, false is returned if there are too few of them.
+func choiceOptions(correct string, distractors []string, count int) ([]string, bool) {
+	options := []string{correct}
+
+	for _, d := range distractors {
+		if len(options) == count {
+			break
+		}
+
+		unique := strings.TrimSpace(d) != ""
+		for _, o := range options {
+			if compareWords(o, d) {
+				unique = false
+			}
+		}
+
+		if unique {
+			options = append(options, d)
+		}
+	}
+
+	if len(options) < count {
+		return nil, false
+	}
+
+	rand.Shuffle(len(options), func(i, j int) {
+		options[i], options[j] = options[j], options[i]
+	})
+
+	return options, true
+}
+
+// choiceCallbackData keeps word id, so buttons of older questions are ignored.
+func choiceCallbackData(wordID, index int) string {
+	return fmt.Sprintf("%s:%d:%d", choiceCallbackPrefix, wordID, index)
+}
+
+func parseChoiceCallback(data string) (wordID, index int, err error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != choiceCallbackPrefix {
+		return 0, 0, errInvalidCallback
+	}
+
+	wordID, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, errInvalidCallback
+	}
+
+	index, err = strconv.Atoi(parts[2])
+	if err != nil || index < 0 {
+		return 0, 0, errInvalidCallback
+	}
+
+	return wordID, index, nil
+}
@@ -0,0 +1,62 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestChoiceOptions(t *testing.T) {
+	options, ok := choiceOptions("even", []string{"Even ", "lock", "", "fish", "lock", "day"}, 4)
+	if !ok {
+		t.Fatalf("Options expected")
+	}
+
+	found := make(map[string]bool)
+	for _, o := range options {
+		found[o] = true
+	}
+
+	if len(options) != 4 || !found["even"] || !found["lock"] || !found["fish"] || !found["day"] {
+		t.Fatalf("Invalid options: %v", options)
+	}
+
+	_, ok = choiceOptions("even", []string{"even", "lock"}, 4)
+	if ok {
+		t.Fatalf("Too few distinct options shouldn't be used")
+	}
+}
+
+func TestFillDistractors(t *testing.T) {
+	words := []word{{id: 1, word: "Tür"}, {id: 2, word: "Haus"}, {id: 3, word: "Türe"}, {id: 4, word: "Bank"}, {id: 5, word: "Ufer"}}
+	live := map[string]string{"Tür": "door", "Haus": "house", "Türe": "door", "Bank": "bank", "Ufer": "shore"}
+
+	calls := 0
+	translate := func(w word) (string, error) {
+		calls++
+		return live[w.word], nil
+	}
+
+	distractors := fillDistractors("even", words, map[int]string{}, translate)
+	if _, ok := choiceOptions("even", distractors, choiceOptionsCount); !ok || calls != 4 {
+		t.Fatalf("Uncached words should be translated until there are enough options: %v, %d calls", distractors, calls)
+	}
+
+	calls = 0
+	distractors = fillDistractors("even", words, map[int]string{1: "door", 2: "house", 4: "bank"}, translate)
+	if _, ok := choiceOptions("even", distractors, choiceOptionsCount); !ok || calls != 0 {
+		t.Fatalf("Cached translations should be used first: %v, %d calls", distractors, calls)
+	}
+}
+
+func TestParseChoiceCallback(t *testing.T) {
+	wordID, index, err := parseChoiceCallback(choiceCallbackData(42, 3))
+	if err != nil || wordID != 42 || index != 3 {
+		t.Fatalf("Invalid callback parsed: %d, %d, %v", wordID, index, err)
+	}
+
+	for _, data := range []string{"", "choice:42", "choice:x:1", "choice:42:-1", "other:42:1"} {
+		_, _, err := parseChoiceCallback(data)
+		if err != errInvalidCallback {
+			t.Fatalf("Callback %q should be rejected", data)
+		}
+	}
+}
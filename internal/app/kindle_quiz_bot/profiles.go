@@ -0,0 +1,248 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errInvalidSelection = errors.New("invalid selection")
+
+// profilesToImport returns ids of the uploaded file profiles to import.
+// Stored choices are reused, unknown profiles make user choose them,
+// in this case nil is returned and the file is kept as pending upload.
+func (q *quiz) profilesToImport(userId int, path string) ([]string, error) {
+	profiles, err := readProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(profiles) < 2 {
+		ids := make([]string, 0, len(profiles))
+		for _, p := range profiles {
+			ids = append(ids, p.id)
+		}
+		return ids, nil
+	}
+
+	choices, err := q.repo.getProfileChoices(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		isSelected, ok := choices[p.id]
+		if !ok {
+			return nil, q.askProfiles(userId, path, profiles)
+		}
+
+		if isSelected {
+			selected = append(selected, p.id)
+		}
+	}
+
+	msg := "Found profiles:\n\n" + formatProfiles(profiles, choices)
+	msg += "\nSelected profiles are used. Run /profiles to choose them again on next upload."
+	q.sendMessage(userId, msg)
+
+	return selected, nil
+}
+
+func (q *quiz) askProfiles(userId int, path string, profiles []deviceProfile) error {
+	err := q.keepPendingUpload(userId, pendingUpload{path: path})
+	if err != nil {
+		return err
+	}
+
+	err = q.repo.updateUserState(userId, awaitingProfile)
+	if err != nil {
+		return err
+	}
+
+	msg := "Your vocab.db has several profiles:\n\n" + formatProfiles(profiles, nil)
+	msg += "\nSend numbers of profiles to import separated by commas, or \"all\"."
+	q.sendMessage(userId, msg)
+
+	return nil
+}
+
+func (q *quiz) selectProfiles(u user, text string) {
+	upload, err := q.repo.getPendingUpload(u.id)
+	if err == sql.ErrNoRows {
+		q.sendMessage(u.id, "Upload expired, please run /upload again")
+		_ = q.repo.updateUserState(u.id, readyForQuestion)
+		return
+	}
+	if err != nil {
+		log.Printf("select profiles: %v", err)
+		return //TODO: error handle
+	}
+
+	profiles, err := readProfiles(upload.path)
+	if err != nil {
+		log.Printf("select profiles: %v", err)
+		q.sendMessage(u.id, "Upload expired, please run /upload again")
+		q.discardPendingUpload(u.id)
+		_ = q.repo.updateUserState(u.id, readyForQuestion)
+		return
+	}
+
+	numbers, err := parseSelection(text, len(profiles))
+	if err != nil {
+		q.sendMessage(u.id, "Send numbers of profiles separated by commas, or \"all\". /cancel to cancel upload.")
+		return
+	}
+
+	choices := make(map[string]bool, len(profiles))
+	for _, p := range profiles {
+		choices[p.id] = false
+	}
+	for _, n := range numbers {
+		choices[profiles[n-1].id] = true
+	}
+
+	err = q.repo.setProfileChoices(u.id, choices)
+	if err != nil {
+		log.Printf("select profiles: %v", err)
+		return //TODO: error handle
+	}
+
+	err = q.repo.deletePendingUpload(u.id)
+	if err != nil {
+		log.Printf("select profiles: %v", err)
+	}
+
+	err = q.repo.updateUserState(u.id, migrationInProgress)
+	if err != nil {
+		log.Printf("select profiles: %v", err)
+	}
+
+	q.enqueueMigration(migrationJob{downloadJob: downloadJob{userId: u.id}, documentPath: upload.path})
+}
+
+func (q *quiz) ResetProfiles(userId int) {
+	err := q.repo.deleteProfileChoices(userId)
+	if err != nil {
+		log.Printf("reset profiles: %v", err)
+		return //TODO: error handle
+	}
+
+	q.sendMessage(userId, "You will choose kindle profiles on next /upload")
+}
+
+// discardPendingUpload removes the file user didn't decide about.
+func (q *quiz) discardPendingUpload(userId int) {
+	upload, err := q.repo.getPendingUpload(userId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("discard upload: %v", err)
+		}
+		return
+	}
+
+	err = removeUpload(upload.path)
+	if err != nil {
+		log.Printf("discard upload: %v", err)
+	}
+
+	err = q.repo.deletePendingUpload(userId)
+	if err != nil {
+		log.Printf("discard upload: %v", err)
+	}
+}
+
+// keepPendingUpload saves the upload waiting for user's decision,
+// the file of the replaced upload is removed.
+func (q *quiz) keepPendingUpload(userId int, upload pendingUpload) error {
+	old, err := q.repo.getPendingUpload(userId)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	//Chosen profiles are previewed from the same upload
+	if err == nil && filepath.Dir(old.path) != filepath.Dir(upload.path) {
+		err = removeUpload(old.path)
+		if err != nil {
+			log.Printf("replace upload: %v", err)
+		}
+	}
+
+	return q.repo.setPendingUpload(userId, upload)
+}
+
+// removeExpiredUploads removes the files users didn't decide about in pendingUploadTTL.
+func (q *quiz) removeExpiredUploads() {
+	paths, err := q.repo.deleteExpiredPendingUploads(pendingUploadTTL)
+	if err != nil {
+		log.Printf("remove expired uploads: %v", err)
+		return
+	}
+
+	for _, path := range paths {
+		err = removeUpload(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("remove expired uploads: %v", err)
+		}
+	}
+}
+
+func formatProfiles(profiles []deviceProfile, choices map[string]bool) string {
+	msg := ""
+	for i, p := range profiles {
+		mark := ""
+		if selected, ok := choices[p.id]; ok {
+			if selected {
+				mark = " (selected)"
+			} else {
+				mark = " (skipped)"
+			}
+		}
+		msg += fmt.Sprintf("%d. %s: %d words%s\n", i+1, profileName(p.id), p.wordsCount, mark)
+	}
+	return msg
+}
+
+func profileName(id string) string {
+	if id == "" {
+		return "Default profile"
+	}
+	return id
+}
+
+// parseSelection parses numbers from 1 to n separated by commas or spaces, "all" selects everything.
+func parseSelection(text string, n int) ([]int, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+
+	if text == "all" {
+		numbers := make([]int, 0, n)
+		for i := 1; i <= n; i++ {
+			numbers = append(numbers, i)
+		}
+		return numbers, nil
+	}
+
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	if len(fields) == 0 {
+		return nil, errInvalidSelection
+	}
+
+	numbers := make([]int, 0, len(fields))
+	for _, f := range fields {
+		number, err := strconv.Atoi(f)
+		if err != nil || number < 1 || number > n {
+			return nil, errInvalidSelection
+		}
+		numbers = append(numbers, number)
+	}
+
+	return numbers, nil
+}
@@ -0,0 +1,38 @@
+package kindle_quiz_bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	cases := []struct {
+		text     string
+		n        int
+		expected []int
+	}{
+		{"all", 3, []int{1, 2, 3}},
+		{" ALL ", 2, []int{1, 2}},
+		{"1", 2, []int{1}},
+		{"1, 3", 3, []int{1, 3}},
+		{"2 1", 2, []int{2, 1}},
+	}
+
+	for _, c := range cases {
+		numbers, err := parseSelection(c.text, c.n)
+		if err != nil {
+			t.Fatalf("Couldn't parse %q: %v", c.text, err)
+		}
+
+		if !reflect.DeepEqual(numbers, c.expected) {
+			t.Fatalf("Expected %v, got %v", c.expected, numbers)
+		}
+	}
+
+	for _, text := range []string{"", "0", "4", "one", "1,,x"} {
+		_, err := parseSelection(text, 3)
+		if err != errInvalidSelection {
+			t.Fatalf("Selection %q should be invalid", text)
+		}
+	}
+}
@@ -1,12 +1,11 @@
 package kindle_quiz_bot
 
 import (
+	"database/sql"
 	"fmt"
-	"github.com/bregydoc/gtranslate"
-	"io"
 	"log"
-	"net/http"
-	"os"
+	"math/rand"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +16,9 @@ const (
 	maxDownloadJobsCount     = 3
 )
 
+// maxDocumentSize is the largest file Telegram lets bots download.
+const maxDocumentSize = 20 << 20
+
 type Quiz interface {
 	Close()
 	Greetings(userId int)
@@ -25,30 +27,63 @@ type Quiz interface {
 	SelectLang(userId int)
 	AwaitUpload(userId int)
 	CancelOperation(userId int)
-	ProcessMessage(userId int, text, documentUrl string)
+	ToggleContext(userId int)
+	ToggleMastered(userId int)
+	ShowBooks(userId int)
+	SelectBook(userId int, arg string)
+	ResetProfiles(userId int)
+	ConfirmImport(userId int)
+	ShowImports(userId int)
+	UndoImport(userId int, arg string)
+	SelectMode(userId int, arg string)
+	SelectDirection(userId int, arg string)
+	DisputeAnswer(userId int)
+	StartSession(userId int, arg string)
+	StopSession(userId int)
+	ShowHint(userId int)
+	SetMastery(userId int, arg string)
+	SkipWord(userId int)
+	ShowDisputes(userId int)
+	ProcessMessage(userId int, text string)
+	ProcessCallback(userId int, data string)
+	ProcessDocument(userId int, d document)
 }
 
 type quiz struct {
 	repo          *repository
 	sender        MessageSender
-	downloadJobs  chan downloadJob
-	migrationJobs chan migrationJob
+	downloadJobs  chan struct{}
+	migrationJobs chan struct{}
+	stop          chan struct{}
+	downloader    *downloader
 }
 
 type guessRequest struct {
-	userId int
-	word   word
+	userId    int
+	word      word
+	direction quizDirection
+	kind      questionKind
 }
 
 type guessParams struct {
-	word   word
-	guess  string
-	userID int
+	word      word
+	guess     string
+	userID    int
+	direction quizDirection
+	kind      questionKind
+	// answerLang is a code of the expected answer language
+	answerLang string
+	// hints is a number of hints taken before the guess
+	hints int
+	// rating is the grade of the flashcard given by the user
+	rating cardRating
 }
 
 type guessResult struct {
 	params      guessParams
 	translation string
+	// alternatives are other accepted translations
+	alternatives []string
 }
 
 type word struct {
@@ -58,9 +93,42 @@ type word struct {
 	langId int
 }
 
+// vocabWord is a word entry read from the device vocabulary.
+type vocabWord struct {
+	word      string
+	stem      string
+	lc        string
+	category  int
+	timestamp int64
+}
+
 type user struct {
-	id           int
-	currentState userState
+	id              int
+	currentState    userState
+	showContext     bool
+	quizBook        sql.NullInt64
+	includeMastered bool
+	quizMode        quizMode
+	reviewer        bool
+}
+
+type book struct {
+	id         int
+	key        string
+	asin       string
+	title      string
+	authors    string
+	lang       string
+	wordsCount int
+}
+
+type lookup struct {
+	id        int
+	wordID    int
+	usage     string
+	bookKey   string
+	pos       string
+	timestamp int64
 }
 
 type lang struct {
@@ -70,74 +138,140 @@ type lang struct {
 	localizedName string
 }
 
+// document is a file sent to the bot, fileId is resolved
+// to the download url when the file is downloaded.
+type document struct {
+	name   string
+	size   int
+	fileId string
+}
+
 type downloadJob struct {
-	userId      int
-	documentUrl string
+	id     int
+	userId int
+	fileId string
+	size   int64
 }
 
 type migrationJob struct {
 	downloadJob
 	documentPath string
+	profiles     []string
+	confirmed    bool
+}
+
+// pendingUploadTTL is how long uploaded file waits for user's decision.
+const pendingUploadTTL = 24 * time.Hour
+
+// pendingUpload is uploaded file waiting for user's decision,
+// profiles are nil until user chooses them.
+type pendingUpload struct {
+	path     string
+	profiles []string
 }
 
 type MessageSender interface {
 	SendMessage(userId int, text string) error
+	SendKeyboard(userId int, text string, rows [][]button) error
+	// FileURL returns the download url of the file, urls expire,
+	// so they are requested right before the download.
+	FileURL(fileId string) (string, error)
 }
 
 func (q *quiz) Close() {
+	close(q.stop)
 	q.repo.close()
-	close(q.migrationJobs)
 }
 
 func NewQuiz(s MessageSender) Quiz {
 	q := quiz{sender: s}
 
+	rand.Seed(time.Now().UnixNano())
+
 	err := q.connectToDB()
 	if err != nil {
 		log.Fatalf("db connect: %v", err.Error())
 	}
 
-	q.downloadJobs = make(chan downloadJob, 20)
-	q.migrationJobs = make(chan migrationJob, 20)
+	q.downloadJobs = make(chan struct{}, maxDownloadJobsCount)
+	q.migrationJobs = make(chan struct{}, maxMigrationWorkersCount)
+	q.stop = make(chan struct{})
+	q.downloader = newDownloader()
+
+	q.recoverJobs()
+	q.removeExpiredUploads()
 
 	for i := 0; i < maxDownloadJobsCount; i++ {
-		go q.downloadWorker(q.downloadJobs)
+		go q.downloadWorker()
 	}
 
 	for i := 0; i < maxMigrationWorkersCount; i++ {
-		go q.migrationWorker(q.migrationJobs)
+		go q.migrationWorker()
 	}
 
+	notifyWorkers(q.downloadJobs)
+	notifyWorkers(q.migrationJobs)
+
 	return &q
 }
 
 func (q *quiz) RequestWord(userId int) {
 	log.Println("request word")
 
-	w, err := q.repo.getRandomWord(userId)
+	err := q.askNextWord(userId)
 
 	if err == errNoWordsFound {
-		q.sendMessage(userId, "No words found. Please run /upload and follow instructions")
+		q.sendMessage(userId, "No words found. Please run /upload and follow instructions, or select another book in /books")
 		return
 	}
 
 	if err != nil {
 		log.Println("report error: random word")
 		q.sendMessage(userId, err.Error())
-		return
+	}
+}
+
+// askNextWord asks the next word, errNoWordsFound is returned if there is nothing to ask.
+func (q *quiz) askNextWord(userId int) error {
+	w, err := q.repo.getNextWord(userId)
+	if err != nil {
+		return err
+	}
+
+	direction, kind, err := q.repo.getQuestionType(userId)
+	if err != nil {
+		log.Printf("question type: %v", err)
 	}
 
 	log.Println("send request")
-	r := guessRequest{userId, *w}
+	r := guessRequest{userId, *w, direction, kind}
 	q.ask(r)
+	return nil
 }
 
 func (q *quiz) ShowHelp(userId int) {
 	msg := `
 /quiz - ask a random word
+/session <n> - ask n words in a row, 20 by default
+/hint - show the first letter, the length and then the usage of the answer
+/skip - show the answer when you don't know it
+/stop - finish the session early
+/books - list your books
+/quiz_book <n> - ask words only from book n, 0 for all books
 /help - show this help
 /set_lang - change language
-/upload - uploading mode
+/mode - choose quiz mode: typing, multiple choice, cloze or flashcards
+/direction - ask translations, words or both
+/context - show or hide usage sentences in questions
+/mastered - include or skip words mastered on kindle or retired by the quiz
+/mastery <n> - retire words after n correct answers in a row, 0 to never retire
+/upload - upload kindle vocab.db or My Clippings.txt, KoboReader.sqlite or KOReader vocabulary_builder.sqlite3
+/confirm - import uploaded file after preview
+/imports - list your imports
+/undo_import <id> - remove words introduced by the import
+/profiles - choose kindle profiles again on next upload
+/dispute - send your last incorrect translation for review
+/disputes - review disputed answers, for reviewers only
 /cancel - cancel current operation
 `
 	q.sendMessage(userId, msg)
@@ -176,13 +310,16 @@ func (q *quiz) SelectLang(userId int) {
 }
 
 func (q *quiz) AwaitUpload(userId int) {
+	q.discardPendingUpload(userId)
+	q.removeExpiredUploads()
+
 	err := q.repo.updateUserState(userId, awaitingUpload)
 	if err != nil {
 		log.Printf("await upload: %v", err)
 		return //TODO: Error handle
 	}
 
-	q.sendMessage(userId, "Now send vocab.db file exported from your kindle")
+	q.sendMessage(userId, "Now send vocab.db or My Clippings.txt from your kindle, KoboReader.sqlite from your kobo or vocabulary_builder.sqlite3 from KOReader. Files larger than 20 MB can be packed into .zip or .gz")
 }
 
 func (q *quiz) CancelOperation(userId int) {
@@ -197,6 +334,10 @@ func (q *quiz) CancelOperation(userId int) {
 		return
 	}
 
+	if user.currentState == awaitingProfile || user.currentState == awaitingConfirmation {
+		q.discardPendingUpload(userId)
+	}
+
 	err = q.repo.updateUserState(userId, readyForQuestion)
 	if err != nil {
 		log.Printf("await upload: %v", err)
@@ -206,7 +347,143 @@ func (q *quiz) CancelOperation(userId int) {
 	q.sendMessage(userId, "Done")
 }
 
-func (q *quiz) ProcessMessage(userId int, text, documentUrl string) {
+func (q *quiz) ToggleContext(userId int) {
+	showContext, err := q.repo.toggleShowContext(userId)
+	if err != nil {
+		log.Printf("toggle context: %v", err)
+		return //TODO: error handle
+	}
+
+	if showContext {
+		q.sendMessage(userId, "Usage sentences will be shown in questions")
+	} else {
+		q.sendMessage(userId, "Usage sentences are hidden now")
+	}
+}
+
+func (q *quiz) ToggleMastered(userId int) {
+	includeMastered, err := q.repo.toggleIncludeMastered(userId)
+	if err != nil {
+		log.Printf("toggle mastered: %v", err)
+		return //TODO: error handle
+	}
+
+	if includeMastered {
+		q.sendMessage(userId, "Words mastered on kindle or retired by the quiz will be asked too")
+	} else {
+		q.sendMessage(userId, "Words mastered on kindle or retired by the quiz will be skipped")
+	}
+}
+
+// SetMastery sets the number of correct answers in a row retiring the word.
+func (q *quiz) SetMastery(userId int, arg string) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		threshold, err := q.repo.getMasteryThreshold(userId)
+		if err != nil {
+			log.Printf("set mastery: %v", err)
+			return //TODO: error handle
+		}
+
+		if threshold == 0 {
+			q.sendMessage(userId, "Words are never retired. Run /mastery <n> to retire words after n correct answers in a row")
+		} else {
+			q.sendMessage(userId, fmt.Sprintf("Words are retired after %d correct answers in a row. Run /mastery <n> to change it, 0 to never retire words", threshold))
+		}
+		return
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 || n > maxMasteryThreshold {
+		q.sendMessage(userId, fmt.Sprintf("Usage: /mastery <n>, where n is a number from 0 to %d", maxMasteryThreshold))
+		return
+	}
+
+	err = q.repo.setMasteryThreshold(userId, n)
+	if err != nil {
+		log.Printf("set mastery: %v", err)
+		return //TODO: error handle
+	}
+
+	if n == 0 {
+		q.sendMessage(userId, "Words will never be retired")
+	} else {
+		q.sendMessage(userId, fmt.Sprintf("Words will be retired after %d correct answers in a row", n))
+	}
+}
+
+func (q *quiz) ShowBooks(userId int) {
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("show books: %v", err)
+		return //TODO: error handle
+	}
+
+	books, err := q.repo.getBooks(userId)
+	if err != nil {
+		log.Printf("show books: %v", err)
+		q.sendMessage(userId, "Couldn't load your books")
+		return
+	}
+
+	if len(books) == 0 {
+		q.sendMessage(userId, "No books found. Please run /upload and follow instructions")
+		return
+	}
+
+	msg := "Your books:\n\n"
+	for i, b := range books {
+		mark := ""
+		if u.quizBook.Valid && int(u.quizBook.Int64) == b.id {
+			mark = " (selected)"
+		}
+		msg += fmt.Sprintf("%d. %s — %s: %d words%s\n", i+1, b.title, b.authors, b.wordsCount, mark)
+	}
+	msg += "\nRun /quiz_book <n> to ask words only from book n, /quiz_book 0 to ask from all books"
+
+	q.sendMessage(userId, msg)
+}
+
+func (q *quiz) SelectBook(userId int, arg string) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || n < 0 {
+		q.sendMessage(userId, "Usage: /quiz_book <n>, where n is a number from /books")
+		return
+	}
+
+	if n == 0 {
+		err = q.repo.setQuizBook(userId, nil)
+		if err != nil {
+			log.Printf("select book: %v", err)
+			return //TODO: error handle
+		}
+		q.sendMessage(userId, "Words will be asked from all your books")
+		return
+	}
+
+	books, err := q.repo.getBooks(userId)
+	if err != nil {
+		log.Printf("select book: %v", err)
+		q.sendMessage(userId, "Couldn't load your books")
+		return
+	}
+
+	if n > len(books) {
+		q.sendMessage(userId, "Invalid book number, see /books")
+		return
+	}
+
+	b := books[n-1]
+	err = q.repo.setQuizBook(userId, &b.id)
+	if err != nil {
+		log.Printf("select book: %v", err)
+		return //TODO: error handle
+	}
+
+	q.sendMessage(userId, fmt.Sprintf("Words will be asked from: %s", b.title))
+}
+
+func (q *quiz) ProcessMessage(userId int, text string) {
 	u, err := q.repo.getUser(userId)
 	if err != nil {
 		log.Printf("await upload: %v", err)
@@ -217,100 +494,164 @@ func (q *quiz) ProcessMessage(userId int, text, documentUrl string) {
 
 	switch u.currentState {
 	case awaitingUpload:
-		q.downloadJobs <- downloadJob{userId, documentUrl}
+		q.sendMessage(userId, "Send the file as a document, or /cancel to cancel upload")
 	case readyForQuestion:
 		q.ShowHelp(u.id)
 	case waitingAnswer:
+		if strings.TrimSpace(text) == "" {
+			q.sendMessage(userId, "Type the answer, or /hint for a hint, or /skip to see the answer")
+			return
+		}
 		q.guessWord(*u, text)
 	case migrationInProgress:
 		q.showMigrationInProgressWarn(userId)
 	case awaitingLanguage:
 		q.setLanguage(*u, text)
+	case awaitingProfile:
+		q.selectProfiles(*u, text)
+	case awaitingConfirmation:
+		q.sendMessage(userId, "Send /confirm to import the file or /cancel to discard it")
+	}
+}
+
+func (q *quiz) ProcessDocument(userId int, d document) {
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("process document: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState != awaitingUpload {
+		q.sendMessage(userId, "Run /upload before sending the file")
+		return
+	}
+
+	if d.size > maxDocumentSize {
+		msg := fmt.Sprintf("The file is too large: %d MB, bots can download files up to %d MB. ", d.size>>20, maxDocumentSize>>20)
+		msg += "Pack it into .zip or .gz archive and send the archive."
+		q.sendMessage(userId, msg)
+		return
+	}
+
+	if d.fileId == "" {
+		q.sendMessage(userId, "Telegram couldn't give me the file, please send it again")
+		return
 	}
+
+	q.enqueueDownload(downloadJob{userId: userId, fileId: d.fileId, size: int64(d.size)})
 }
 
 func (q *quiz) guessWord(u user, guess string) {
+	q.answerWord(u, guess, noRating)
+}
+
+// answerWord records the answer to the current question, flashcards
+// are answered with the rating instead of the guess.
+func (q *quiz) answerWord(u user, guess string, rating cardRating) {
 	word, err := q.repo.getLastWord(u.id)
 	if err != nil {
 		q.sendMessage(u.id, err.Error())
 		return
 	}
 
+	direction, kind, err := q.repo.getQuestionType(u.id)
+	if err != nil {
+		q.sendMessage(u.id, err.Error())
+		return
+	}
+
 	lang, err := q.repo.getUserLanguage(u.id)
 	if err != nil {
 		q.sendMessage(u.id, err.Error())
 		return
 	}
 
-	translated, err := q.translateWord(*word, lang)
+	translations, err := q.translations(*word, lang)
+	if err != nil {
+		q.sendMessage(u.id, err.Error())
+		return
+	}
+
+	hints, err := q.repo.getQuestionHints(u.id)
 	if err != nil {
 		q.sendMessage(u.id, err.Error())
 		return
 	}
 
+	answerLang := lang.code
+	if direction == reverseDirection {
+		wordLang, err := q.repo.getLang(word.langId)
+		if err != nil {
+			q.sendMessage(u.id, err.Error())
+			return
+		}
+		answerLang = wordLang.code
+	}
+
 	err = q.repo.deleteLastWord(u.id)
 	if err != nil {
 		q.sendMessage(u.id, err.Error())
 		return
 	}
 
-	p := guessParams{*word, guess, u.id}
-	r := guessResult{p, translated}
+	if kind == flashcardQuestion && rating == noRating {
+		//The card answered by typing is graded as typed answer
+		kind = translationQuestion
+	}
+
+	p := guessParams{*word, guess, u.id, direction, kind, answerLang, hints, rating}
+	r := guessResult{p, translations[0], translations[1:]}
 
-	q.tellResult(r)
+	if kind == flashcardQuestion {
+		q.sendMessage(u.id, fmt.Sprintf("Rated: %s", rating))
+	} else {
+		q.tellResult(r)
+	}
 
-	err = q.repo.persistAnswer(r)
+	retired, err := q.repo.persistAnswer(r)
 	if err != nil {
 		log.Printf("Failed to write answer: %v\n", err.Error())
+	} else if retired {
+		q.sendMessage(u.id, fmt.Sprintf("%s is mastered and won't be asked anymore, /mastered brings mastered words back", word.word))
 	}
 
 	err = q.repo.updateUserState(u.id, readyForQuestion)
 	if err != nil {
 		log.Printf("Couldn't update user state: %v", err)
 	}
+
+	q.continueSession(u.id)
 }
 
-func (q *quiz) tryToMigrate(userId int, path string) error {
+func (q *quiz) tryToMigrate(userId int, path string, profiles []string) (*importStats, error) {
 	err := q.repo.updateUserState(userId, migrationInProgress)
 	if err != nil {
-		return fmt.Errorf("migrate: update state: %v", err.Error())
+		return nil, fmt.Errorf("migrate: update state: %v", err.Error())
 	}
 
-	err = migrateFromKindleSQLite(path, userId, q.repo)
+	stats, err := migrateUpload(path, userId, q.repo, profiles)
 	if err != nil {
+		log.Printf("migration: %v", err)
 		q.sendMessage(userId, "Looks like db file in incorrect format. Try again.")
-		return nil
+		_ = q.repo.updateUserState(userId, readyForQuestion)
+		return nil, nil
 	}
 
 	err = q.repo.updateUserState(userId, readyForQuestion)
 	if err != nil {
-		return fmt.Errorf("downloading document: %v", err.Error())
+		return nil, fmt.Errorf("downloading document: %v", err.Error())
 	}
 
-	return nil
+	return &stats, nil
 }
 
 func(q *quiz) translateWord(w word, dst *lang) (string, error) {
-	lang, err := q.repo.getLang(w.langId)
+	translations, err := q.translations(w, dst)
 	if err != nil {
 		return "", err
 	}
 
-	translated, err := gtranslate.TranslateWithParams(
-		w.word,
-		gtranslate.TranslationParams{
-			From:  lang.code,
-			To:    dst.code,
-			Delay: time.Second,
-			Tries: 5,
-		},
-	)
-
-	if err != nil {
-		return "", err
-	}
-
-	return translated, nil
+	return translations[0], nil
 }
 
 func compareWords(w1, w2 string) bool {
@@ -353,10 +694,30 @@ func (q *quiz) connectToDB() error {
 }
 
 func (q *quiz) tellResult(r guessResult) {
-	if r.correct() {
-		q.sendMessage(r.params.userID, "Your answer is correct")
-	} else {
-		q.sendMessage(r.params.userID, fmt.Sprintf("Your answer is incorrect. Correct answer: %s\n", r.translation))
+	if r.skipped() {
+		q.sendMessage(r.params.userID, fmt.Sprintf("Correct answer: %s\n", r.answer()))
+		return
+	}
+
+	hints := ""
+	if r.params.hints > 0 {
+		hints = fmt.Sprintf(" with %d hint(s)", r.params.hints)
+	}
+
+	switch r.evaluate() {
+	case gradeCorrect:
+		q.sendMessage(r.params.userID, "Your answer is correct"+hints)
+	case gradeAlmostCorrect:
+		q.sendMessage(r.params.userID, fmt.Sprintf("Almost correct%s, mind the typo: %s\nCorrect answer: %s\n", hints, strings.TrimSpace(r.params.guess), r.answer()))
+	default:
+		msg := fmt.Sprintf("Your answer is incorrect. Correct answer: %s\n", r.answer())
+		if r.params.direction != reverseDirection {
+			if len(r.alternatives) > 0 {
+				msg += fmt.Sprintf("Also accepted: %s\n", strings.Join(r.alternatives, ", "))
+			}
+			msg += "Send /dispute if you think your answer is correct too.\n"
+		}
+		q.sendMessage(r.params.userID, msg)
 	}
 }
 
@@ -368,13 +729,197 @@ func (q *quiz) ask(r guessRequest) {
 		return
 	}
 
+	if r.kind == flashcardQuestion {
+		err = q.askFlashcard(r, lang)
+		if err != nil {
+			q.sendMessage(r.userId, err.Error())
+		}
+		return
+	}
+
+	if r.kind == clozeQuestion {
+		question, ok, err := q.clozeQuestion(r, lang)
+		if err != nil {
+			log.Printf("cloze question: %v", err)
+		}
+		if ok {
+			q.sendMessage(r.userId, question)
+			return
+		}
+		//The sentence has no word, cloze is answered like reverse question
+	}
+
 	w := r.word
 	question := fmt.Sprintf("Word is: %s; Stem: %s; Lang: %s\n", w.word, w.stem, lang.englishName)
+
+	usage, err := q.usageContext(r.userId, w)
+	if err != nil {
+		log.Printf("usage context: %v", err)
+	}
+	if usage != "" {
+		question += fmt.Sprintf("\nContext: %s\n", highlightWord(usage, w.word))
+	}
+
+	if r.direction == reverseDirection {
+		userLang, err := q.repo.getUserLanguage(r.userId)
+		if err != nil {
+			q.sendMessage(r.userId, err.Error())
+			return
+		}
+
+		translation, err := q.translateWord(w, userLang)
+		if err != nil {
+			q.sendMessage(r.userId, err.Error())
+			return
+		}
+
+		question = reverseQuestion(translation, usage, w, lang)
+	}
+
+	u, err := q.repo.getUser(r.userId)
+	if err != nil {
+		log.Printf("ask: %v", err)
+	}
+
+	if u != nil && u.quizMode == choiceMode {
+		asked, err := q.askChoice(r, question)
+		if err != nil {
+			log.Printf("ask choice: %v", err)
+		}
+		if asked {
+			return
+		}
+		//Too few words for the options, so the answer is typed
+		if r.kind == choiceQuestion {
+			err = q.repo.setQuestionKind(r.userId, translationQuestion)
+			if err != nil {
+				log.Printf("ask: %v", err)
+			}
+		}
+		if r.direction != reverseDirection {
+			question += "\nType the translation:"
+		}
+	}
+
 	q.sendMessage(r.userId, question)
 }
 
+// usageContext returns the sentence the word was looked up in,
+// or an empty string if the user disabled context or there is none.
+func (q *quiz) usageContext(userId int, w word) (string, error) {
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		return "", err
+	}
+
+	if !u.showContext {
+		return "", nil
+	}
+
+	l, err := q.repo.getLookup(userId, w.id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(l.usage), nil
+}
+
+func highlightWord(sentence, w string) string {
+	sentence = strings.TrimSpace(sentence)
+
+	indexes := wordIndexes(sentence, w)
+	if len(indexes) == 0 {
+		return sentence
+	}
+
+	loc := indexes[0]
+	return sentence[:loc[0]] + "*" + sentence[loc[0]:loc[1]] + "*" + sentence[loc[1]:]
+}
+
+// evaluate compares the guess with the answer, reverse guess can be the word or its stem.
+func (t *guessResult) evaluate() answerGrade {
+	expected := append([]string{t.translation}, t.alternatives...)
+	if t.params.direction == reverseDirection {
+		expected = []string{t.params.word.word, t.params.word.stem}
+	}
+
+	grade := gradeIncorrect
+	for _, e := range expected {
+		g := evaluateAnswer(t.params.guess, e, t.params.answerLang)
+		if t.params.kind == choiceQuestion && g != gradeCorrect {
+			//The option is chosen, not typed, so similar options aren't typos
+			g = gradeIncorrect
+		}
+		if g > grade {
+			grade = g
+		}
+	}
+	return grade
+}
+
+// grade is the evaluated guess lowered by one step for every hint taken,
+// hints don't make the answer incorrect. Flashcards are graded by the user.
+func (t *guessResult) grade() answerGrade {
+	if t.params.kind == flashcardQuestion {
+		return t.params.rating.grade()
+	}
+
+	evaluated := t.evaluate()
+	if evaluated == gradeIncorrect {
+		return evaluated
+	}
+
+	grade := evaluated - answerGrade(t.params.hints)
+	if grade < gradeAlmostCorrect {
+		return gradeAlmostCorrect
+	}
+	return grade
+}
+
+// correct is true only for the exact answer, typos are saved as almost correct grade.
+// The answer given with hints is still correct, its grade and quality are lowered.
 func (t *guessResult) correct() bool {
-	return compareWords(t.params.guess, t.translation)
+	if t.params.kind == flashcardQuestion {
+		return t.grade() == gradeCorrect
+	}
+	return t.evaluate() == gradeCorrect
+}
+
+// recalled is true for correct answers without typos and hints,
+// only such answers keep the streak.
+func (t *guessResult) recalled() bool {
+	return t.grade() == gradeCorrect
+}
+
+// skipped is true if the user gave up without a guess.
+func (t *guessResult) skipped() bool {
+	return strings.TrimSpace(t.params.guess) == ""
+}
+
+// answer is the expected answer shown after incorrect guess.
+func (t *guessResult) answer() string {
+	if t.params.direction != reverseDirection {
+		return t.translation
+	}
+
+	if compareWords(t.params.word.word, t.params.word.stem) {
+		return t.params.word.word
+	}
+	return fmt.Sprintf("%s (%s)", t.params.word.word, t.params.word.stem)
+}
+
+// quality grades the answer for the word scheduling.
+func (t *guessResult) quality() int {
+	return t.record().quality()
+}
+
+// record is the answer as it is stored.
+func (t *guessResult) record() answerRecord {
+	p := t.params
+	return answerRecord{t.correct(), t.grade(), p.hints, p.rating, p.kind, p.guess}
 }
 
 func (q *quiz) sendMessage(userId int, text string) {
@@ -384,70 +929,173 @@ func (q *quiz) sendMessage(userId int, text string) {
 	}
 }
 
-func (q *quiz) migrationWorker(jobs <-chan migrationJob) {
-	for downloadJob := range jobs {
-		func(job migrationJob) {
-			userId := job.userId
-			path := job.documentPath
-
-			defer func() {
-				err := os.Remove(path)
-				if err != nil {
-					log.Printf("downloading document: %v", err.Error())
-				}
-			}()
-
-			q.sendMessage(userId, "Processing...")
-
-			err := q.tryToMigrate(userId, path)
+func (q *quiz) migrationWorker() {
+	for q.waitForJobs(q.migrationJobs) {
+		for {
+			job, err := q.repo.claimMigrationJob()
+			if err == errNoJobs {
+				break
+			}
 			if err != nil {
-				q.sendMessage(userId, "migration failed")
-				return
+				log.Printf("migration worker: %v", err)
+				break
 			}
 
-			q.sendMessage(job.userId, "Migration completed. Press /quiz to start a game.")
-		}(downloadJob)
+			err = q.processMigration(*job)
+			q.finishJob(job.id, err)
+		}
 	}
 }
 
-func (q *quiz) downloadWorker(jobs <-chan downloadJob) {
-	for job := range jobs {
-		userId := job.userId
+// processMigration imports confirmed upload or validates and previews new one,
+// user is told about the failures, returned error is kept with the job.
+func (q *quiz) processMigration(job migrationJob) error {
+	userId := job.userId
+	path := job.documentPath
+	keepFile := false
+
+	defer func() {
+		if keepFile {
+			return
+		}
+
+		err := removeUpload(path)
+		if err != nil {
+			log.Printf("downloading document: %v", err.Error())
+		}
+	}()
+
+	if job.confirmed {
+		q.sendMessage(userId, "Importing...")
+		return q.importUpload(userId, path, job.profiles)
+	}
+
+	q.sendMessage(userId, "Processing...")
 
-		path := strconv.Itoa(userId) + "_vocab.db"
+	path, err := unpackUpload(path)
+	if verr, ok := err.(*validationError); ok {
+		q.sendMessage(userId, fmt.Sprintf("Couldn't import the file. %s", verr.reason))
+		return err
+	}
+	if err != nil {
+		log.Printf("migration: unpack: %v", err)
+		q.sendMessage(userId, "Couldn't read the file, please send it again")
+		return err
+	}
 
-		err := downloadFile(path, job.documentUrl)
+	t, err := validateUpload(path)
+	if verr, ok := err.(*validationError); ok {
+		q.sendMessage(userId, fmt.Sprintf("Couldn't import the file. %s", verr.reason))
+		return err
+	}
+	if err != nil {
+		log.Printf("migration: validation: %v", err)
+		q.sendMessage(userId, "Couldn't read the file, please send it again")
+		return err
+	}
+
+	var profiles []string
+	if t == sqliteUpload {
+		profiles, err = q.profilesToImport(userId, path)
 		if err != nil {
-			//TODO: add retry policy maybe
-			q.sendMessage(userId, "Document couldn't be downloaded")
+			log.Printf("migration: profiles: %v", err)
+			q.sendMessage(userId, "Looks like db file in incorrect format. Try again.")
+			return err
+		}
+
+		if profiles == nil {
+			//User has to choose profiles, file is kept until then
+			keepFile = true
+			return nil
 		}
+	}
 
-		q.migrationJobs <- migrationJob{job, path}
+	err = q.showPreview(userId, path, profiles)
+	if err != nil {
+		log.Printf("migration: preview: %v", err)
+		q.sendMessage(userId, "Looks like db file in incorrect format. Try again.")
+		return err
 	}
+
+	//File is kept until user confirms the import
+	keepFile = true
+	return nil
 }
 
-func downloadFile(filepath string, url string) (err error) {
-	// Get the data
-	resp, err := http.Get(url)
+func (q *quiz) importUpload(userId int, path string, profiles []string) error {
+	stats, err := q.tryToMigrate(userId, path, profiles)
 	if err != nil {
+		q.sendMessage(userId, "migration failed")
 		return err
 	}
-	defer func() {
-		//TODO: error handle
-		_ = resp.Body.Close()
-	}()
 
-	// Create the file
-	out, err := os.Create(filepath)
+	if stats == nil {
+		return fmt.Errorf("import: incorrect file format")
+	}
+
+	msg := fmt.Sprintf("Migration completed: %d new words, %d new lookups. Press /quiz to start a game.", stats.words, stats.lookups)
+	if stats.batchID != 0 {
+		msg += fmt.Sprintf("\nWrong file? Run /undo_import %d to remove it.", stats.batchID)
+	}
+	q.sendMessage(userId, msg)
+
+	return nil
+}
+
+func (q *quiz) downloadWorker() {
+	for q.waitForJobs(q.downloadJobs) {
+		for {
+			job, err := q.repo.claimDownloadJob()
+			if err == errNoJobs {
+				break
+			}
+			if err != nil {
+				log.Printf("download worker: %v", err)
+				break
+			}
+
+			err = q.download(*job)
+			q.finishJob(job.id, err)
+		}
+	}
+}
+
+// download saves the document into the job directory and queues its migration.
+func (q *quiz) download(job downloadJob) error {
+	userId := job.userId
+
+	dir, err := createUploadDir(userId)
 	if err != nil {
+		log.Printf("downloading document: %v", err)
+		q.sendMessage(userId, "Document couldn't be downloaded")
 		return err
 	}
 
-	defer func() {
-		_ = out.Close()
-	}()
+	path := filepath.Join(dir, "upload")
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return err
+	url, err := q.sender.FileURL(job.fileId)
+	if err != nil {
+		log.Printf("downloading document: %v", err)
+		q.sendMessage(userId, "Telegram couldn't give me the file, please send it again")
+		return err
+	}
+
+	err = q.downloader.download(path, url, job.size)
+	if err != nil {
+		log.Printf("downloading document: %v", err)
+		_ = removeUpload(path)
+
+		if derr, ok := err.(*downloadError); ok {
+			q.sendMessage(userId, fmt.Sprintf("Document couldn't be downloaded, %s. Please send it again.", derr.reason))
+		} else if err == errDownloadTooLarge {
+			q.sendMessage(userId, fmt.Sprintf("The file is larger than %d MB. Pack it into .zip or .gz archive and send the archive.", maxDocumentSize>>20))
+		} else {
+			q.sendMessage(userId, "Document couldn't be downloaded. Please send it again.")
+		}
+		return err
+	}
+
+	q.enqueueMigration(migrationJob{downloadJob: downloadJob{userId: userId}, documentPath: path})
+
+	return nil
 }
@@ -0,0 +1,25 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+)
+
+func TestHighlightWord(t *testing.T) {
+	cases := []struct {
+		sentence, word, expected string
+	}{
+		{"Er sperrte die Tür auf. ", "sperrte", "Er *sperrte* die Tür auf."},
+		{"Sogar das.", "sogar", "*Sogar* das."},
+		{"Nothing here", "bank", "Nothing here"},
+		{"Wir haben aufgeräumt", "aufgeräumt", "Wir haben *aufgeräumt*"},
+		{"Something is in the bank", "in", "Something is *in* the bank"},
+		{"Die Bänke an der Bank", "bank", "Die Bänke an der *Bank*"},
+	}
+
+	for _, c := range cases {
+		res := highlightWord(c.sentence, c.word)
+		if res != c.expected {
+			t.Fatalf("Expected %q, got %q", c.expected, res)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package kindle_quiz_bot
 
 import (
+	"fmt"
 	"log"
+	"net/url"
 
 	tg "github.com/go-telegram-bot-api/telegram-bot-api"
 )
@@ -46,6 +48,39 @@ func (bot *quizTelegramBot) SendMessage(userId int, text string) error {
 	return nil
 }
 
+func (bot *quizTelegramBot) FileURL(fileId string) (string, error) {
+	u, err := bot.GetFileDirectURL(fileId)
+	if uerr, ok := err.(*url.Error); ok {
+		//The request url has the bot token
+		return "", fmt.Errorf("get file url: %v", uerr.Err.Error())
+	}
+	if err != nil {
+		return "", fmt.Errorf("get file url: %v", err.Error())
+	}
+
+	return u, nil
+}
+
+func (bot *quizTelegramBot) SendKeyboard(userId int, text string, rows [][]button) error {
+	keyboard := make([][]tg.InlineKeyboardButton, 0, len(rows))
+	for _, row := range rows {
+		buttons := make([]tg.InlineKeyboardButton, 0, len(row))
+		for _, b := range row {
+			buttons = append(buttons, tg.NewInlineKeyboardButtonData(b.text, b.data))
+		}
+		keyboard = append(keyboard, buttons)
+	}
+
+	msg := tg.NewMessage(int64(userId), text)
+	msg.ReplyMarkup = tg.NewInlineKeyboardMarkup(keyboard...)
+	_, err := bot.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (bot quizTelegramBot) Start() error {
 	u := tg.NewUpdate(0)
 	u.Timeout = 60
@@ -60,7 +95,12 @@ func (bot quizTelegramBot) Start() error {
 	q := bot.q
 
 	for update := range updates {
-		if update.Message == nil { // ignore any non-Message Updates
+		if update.CallbackQuery != nil {
+			go bot.processCallback(*update.CallbackQuery, q)
+			continue
+		}
+
+		if update.Message == nil { // ignore any other non-Message Updates
 			continue
 		}
 
@@ -73,36 +113,76 @@ func (bot quizTelegramBot) Start() error {
 	return nil
 }
 
+func (bot quizTelegramBot) processCallback(callback tg.CallbackQuery, q Quiz) {
+	log.Printf("[%s] callback %s", callback.From.UserName, callback.Data)
+
+	//Telegram shows loading indicator on the button until the callback is answered
+	_, err := bot.AnswerCallbackQuery(tg.NewCallback(callback.ID, ""))
+	if err != nil {
+		log.Printf("answer callback: %v", err)
+	}
+
+	q.ProcessCallback(callback.From.ID, callback.Data)
+}
+
 func (bot quizTelegramBot) processUpdate(update tg.Update, q Quiz) {
 	userId := update.Message.From.ID
 
-	switch update.Message.Text {
-	case "/start":
+	switch update.Message.Command() {
+	case "start":
 		q.Greetings(userId)
-	case "/quiz":
+	case "quiz":
 		q.RequestWord(userId)
-	case "/help":
+	case "session":
+		q.StartSession(userId, update.Message.CommandArguments())
+	case "stop":
+		q.StopSession(userId)
+	case "hint":
+		q.ShowHint(userId)
+	case "skip":
+		q.SkipWord(userId)
+	case "books":
+		q.ShowBooks(userId)
+	case "quiz_book":
+		q.SelectBook(userId, update.Message.CommandArguments())
+	case "help":
 		q.ShowHelp(userId)
-	case "/set_lang":
+	case "set_lang":
 		q.SelectLang(userId)
-	case "/upload":
+	case "upload":
 		q.AwaitUpload(userId)
-	case "/cancel":
+	case "cancel":
 		q.CancelOperation(userId)
+	case "profiles":
+		q.ResetProfiles(userId)
+	case "confirm":
+		q.ConfirmImport(userId)
+	case "imports":
+		q.ShowImports(userId)
+	case "undo_import":
+		q.UndoImport(userId, update.Message.CommandArguments())
+	case "mode":
+		q.SelectMode(userId, update.Message.CommandArguments())
+	case "direction":
+		q.SelectDirection(userId, update.Message.CommandArguments())
+	case "dispute":
+		q.DisputeAnswer(userId)
+	case "disputes":
+		q.ShowDisputes(userId)
+	case "context":
+		q.ToggleContext(userId)
+	case "mastered":
+		q.ToggleMastered(userId)
+	case "mastery":
+		q.SetMastery(userId, update.Message.CommandArguments())
 	default:
 		userId := update.Message.From.ID
-		if update.Message.Document != nil {
-
-			url, err := bot.GetFileDirectURL(update.Message.Document.FileID)
-			if err != nil {
-				log.Fatalf(err.Error())
-				return //TODO: Error handling
-			}
-
-			q.ProcessMessage(userId, update.Message.Text, url)
+		if doc := update.Message.Document; doc != nil {
+			d := document{name: doc.FileName, size: doc.FileSize, fileId: doc.FileID}
+			q.ProcessDocument(userId, d)
 
 		} else {
-			q.ProcessMessage(userId, update.Message.Text, "")
+			q.ProcessMessage(userId, update.Message.Text)
 		}
 	}
 }
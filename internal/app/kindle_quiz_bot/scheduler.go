@@ -0,0 +1,140 @@
+package kindle_quiz_bot
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// SM-2 answer qualities, answers below qualityPassed start the word over.
+const (
+	qualityBlackout  = 0
+	qualityIncorrect = 1
+	qualityPassed    = 3
+	qualityGood      = 4
+	qualityEasy      = 5
+)
+
+const (
+	defaultEase = 2.5
+	minEase     = 1.3
+)
+
+// Limits of the word selection weight, the time since the word was asked
+// and how long it is overdue stop raising the weight after them.
+const (
+	maxRecencyHours = 168
+	maxOverdueDays  = 30
+)
+
+// maxMasteryThreshold limits correct answers in a row retiring the word,
+// zero threshold never retires words.
+const maxMasteryThreshold = 50
+
+// schedule is SM-2 state of user's word, zero dueAt means
+// the word wasn't asked yet.
+type schedule struct {
+	ease        float64
+	interval    int
+	repetitions int
+	dueAt       time.Time
+}
+
+// answerRecord is the stored answer, answers are replayed
+// to schedule the word again when the grade of one is changed.
+type answerRecord struct {
+	correct bool
+	grade   answerGrade
+	hints   int
+	rating  cardRating
+	kind    questionKind
+	guess   string
+}
+
+// quality grades the answer for the word scheduling, every hint lowers it by one,
+// so the answer after several hints is scheduled like a lapse.
+func (a answerRecord) quality() int {
+	if a.kind == flashcardQuestion {
+		return a.rating.quality()
+	}
+
+	if strings.TrimSpace(a.guess) == "" {
+		return qualityBlackout
+	}
+
+	quality := qualityIncorrect
+	switch {
+	case a.correct:
+		quality = qualityGood
+	case a.grade != gradeIncorrect:
+		quality = qualityPassed
+	default:
+		return quality
+	}
+
+	quality -= a.hints
+	if quality < qualityIncorrect {
+		return qualityIncorrect
+	}
+	return quality
+}
+
+// replaySchedule schedules the word from scratch by its answers in order,
+// streak is the number of the last answers recalled in a row.
+func replaySchedule(answers []answerRecord, now time.Time) (s schedule, streak int) {
+	s = newSchedule()
+	for _, a := range answers {
+		s = s.next(a.quality(), now)
+
+		if a.grade == gradeCorrect {
+			streak++
+		} else {
+			streak = 0
+		}
+	}
+	return s, streak
+}
+
+func newSchedule() schedule {
+	return schedule{ease: defaultEase}
+}
+
+// next returns the schedule after the answer of the quality given at now.
+func (s schedule) next(quality int, now time.Time) schedule {
+	if quality < qualityBlackout {
+		quality = qualityBlackout
+	}
+	if quality > qualityEasy {
+		quality = qualityEasy
+	}
+
+	n := s
+	if n.ease < minEase {
+		n.ease = defaultEase
+	}
+
+	if quality < qualityPassed {
+		n.repetitions = 0
+		n.interval = 1
+	} else {
+		switch n.repetitions {
+		case 0:
+			n.interval = 1
+		case 1:
+			n.interval = 6
+		default:
+			n.interval = int(math.Round(float64(n.interval) * n.ease))
+		}
+		n.repetitions++
+	}
+
+	d := float64(qualityEasy - quality)
+	n.ease += 0.1 - d*(0.08+d*0.02)
+	if n.ease < minEase {
+		n.ease = minEase
+	}
+
+	n.dueAt = now.AddDate(0, 0, n.interval)
+
+	return n
+}
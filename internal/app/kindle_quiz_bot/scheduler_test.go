@@ -0,0 +1,55 @@
+package kindle_quiz_bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	now := time.Date(2019, time.August, 21, 12, 0, 0, 0, time.UTC)
+
+	s := newSchedule()
+	for i, expected := range []int{1, 6, 15, 38} {
+		s = s.next(qualityGood, now)
+		if s.interval != expected || s.repetitions != i+1 {
+			t.Fatalf("Invalid interval after %d correct answers: %d", i+1, s.interval)
+		}
+	}
+
+	if !s.dueAt.Equal(now.AddDate(0, 0, 38)) {
+		t.Fatalf("Invalid due date: %v", s.dueAt)
+	}
+
+	s = s.next(qualityIncorrect, now)
+	if s.interval != 1 || s.repetitions != 0 || s.ease >= defaultEase {
+		t.Fatalf("Incorrect answer should start the word over: %+v", s)
+	}
+
+	for i := 0; i < 10; i++ {
+		s = s.next(qualityBlackout, now)
+	}
+	if s.ease != minEase {
+		t.Fatalf("Ease should be bounded: %v", s.ease)
+	}
+}
+
+func TestReplaySchedule(t *testing.T) {
+	now := time.Date(2019, time.August, 21, 12, 0, 0, 0, time.UTC)
+	correct := answerRecord{correct: true, grade: gradeCorrect, guess: "shore"}
+	incorrect := answerRecord{grade: gradeIncorrect, guess: "bank"}
+
+	s, streak := replaySchedule([]answerRecord{correct, incorrect}, now)
+	if s.repetitions != 0 || streak != 0 {
+		t.Fatalf("Incorrect answer should start the word over: %+v, %d", s, streak)
+	}
+
+	s, streak = replaySchedule([]answerRecord{correct, correct}, now)
+	if s.repetitions != 2 || s.interval != 6 || streak != 2 || !s.dueAt.Equal(now.AddDate(0, 0, 6)) {
+		t.Fatalf("Accepted answer should be scheduled as correct: %+v, %d", s, streak)
+	}
+
+	hinted := answerRecord{correct: true, grade: gradeAlmostCorrect, hints: 1, guess: "shore"}
+	if hinted.quality() != qualityPassed || (answerRecord{kind: flashcardQuestion, rating: ratingEasy}).quality() != qualityEasy {
+		t.Fatalf("Invalid quality of the stored answer")
+	}
+}
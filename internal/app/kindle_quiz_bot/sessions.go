@@ -0,0 +1,173 @@
+package kindle_quiz_bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSessionLength = 20
+	maxSessionLength     = 100
+)
+
+type sessionStatus string
+
+const (
+	sessionActive   sessionStatus = "active"
+	sessionFinished sessionStatus = "finished"
+	sessionStopped  sessionStatus = "stopped"
+)
+
+// quizSession is a series of questions asked in a row,
+// asked and correct are counted from the answers.
+type quizSession struct {
+	id         int
+	length     int
+	asked      int
+	correct    int
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+// sessionSummary is reported when the session ends, previous is nil for the first session.
+type sessionSummary struct {
+	session  quizSession
+	missed   []string
+	previous *quizSession
+}
+
+// StartSession asks the given number of words in a row.
+func (q *quiz) StartSession(userId int, arg string) {
+	length := defaultSessionLength
+	if arg = strings.TrimSpace(arg); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 || n > maxSessionLength {
+			q.sendMessage(userId, fmt.Sprintf("Usage: /session <n>, where n is a number of words from 1 to %d", maxSessionLength))
+			return
+		}
+		length = n
+	}
+
+	u, err := q.repo.getUser(userId)
+	if err != nil {
+		log.Printf("start session: %v", err)
+		return //TODO: error handle
+	}
+
+	if u.currentState != readyForQuestion && u.currentState != waitingAnswer {
+		q.sendMessage(userId, "Finish the current operation or /cancel it first")
+		return
+	}
+
+	_, err = q.repo.startSession(userId, length)
+	if err == errSessionActive {
+		q.sendMessage(userId, "The session is already in progress, /stop it to start a new one")
+		return
+	}
+	if err != nil {
+		log.Printf("start session: %v", err)
+		q.sendMessage(userId, "Couldn't start the session, try again later")
+		return
+	}
+
+	q.sendMessage(userId, fmt.Sprintf("Session of %d words started, /stop to finish early", length))
+	q.continueSession(userId)
+}
+
+// StopSession finishes the session early and reports the answered words.
+func (q *quiz) StopSession(userId int) {
+	summary, err := q.repo.finishSession(userId, sessionStopped)
+	if err == errNoSession {
+		q.sendMessage(userId, "No session in progress, start one with /session <n>")
+		return
+	}
+	if err != nil {
+		log.Printf("stop session: %v", err)
+		q.sendMessage(userId, "Couldn't stop the session, try again later")
+		return
+	}
+
+	//The question asked in the session is dropped
+	err = q.repo.updateUserState(userId, readyForQuestion)
+	if err != nil {
+		log.Printf("stop session: %v", err)
+	}
+
+	q.sendMessage(userId, formatSummary(*summary))
+}
+
+// continueSession asks the next word of the active session after the answer
+// or reports the summary when the session is over.
+func (q *quiz) continueSession(userId int) {
+	s, err := q.repo.getActiveSession(userId)
+	if err == errNoSession {
+		return
+	}
+	if err != nil {
+		log.Printf("continue session: %v", err)
+		return
+	}
+
+	if s.asked < s.length {
+		err = q.askNextWord(userId)
+		if err == nil {
+			return
+		}
+		if err != errNoWordsFound {
+			log.Printf("continue session: %v", err)
+			q.sendMessage(userId, err.Error())
+			return
+		}
+
+		//Nothing left to ask, the session would stay active forever
+		q.sendMessage(userId, "No more words to ask")
+	}
+
+	summary, err := q.repo.finishSession(userId, sessionFinished)
+	if err != nil {
+		log.Printf("continue session: %v", err)
+		return
+	}
+
+	q.sendMessage(userId, formatSummary(*summary))
+}
+
+func formatSummary(s sessionSummary) string {
+	cur := s.session
+	if cur.asked == 0 {
+		return "Session finished, no words were answered"
+	}
+
+	msg := fmt.Sprintf("Session finished: %d of %d correct (%d%%) in %s\n",
+		cur.correct, cur.asked, score(cur), cur.finishedAt.Sub(cur.startedAt).Round(time.Second))
+
+	if len(s.missed) > 0 {
+		msg += fmt.Sprintf("Missed words: %s\n", strings.Join(s.missed, ", "))
+	}
+
+	if s.previous != nil {
+		prev := score(*s.previous)
+		diff := score(cur) - prev
+		switch {
+		case diff > 0:
+			msg += fmt.Sprintf("That's %d%% better than the previous session (%d%%)\n", diff, prev)
+		case diff < 0:
+			msg += fmt.Sprintf("That's %d%% worse than the previous session (%d%%)\n", -diff, prev)
+		default:
+			msg += fmt.Sprintf("Same score as the previous session (%d%%)\n", prev)
+		}
+	}
+
+	return msg
+}
+
+// score is a percentage of correct answers.
+func score(s quizSession) int {
+	if s.asked == 0 {
+		return 0
+	}
+	return s.correct * 100 / s.asked
+}
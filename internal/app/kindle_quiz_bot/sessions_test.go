@@ -0,0 +1,30 @@
+package kindle_quiz_bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatSummary(t *testing.T) {
+	start := time.Date(2019, 9, 1, 10, 0, 0, 0, time.UTC)
+	s := sessionSummary{
+		session:  quizSession{length: 10, asked: 4, correct: 3, startedAt: start, finishedAt: start.Add(95 * time.Second)},
+		missed:   []string{"Ufer"},
+		previous: &quizSession{asked: 10, correct: 5},
+	}
+
+	msg := formatSummary(s)
+	for _, expected := range []string{"3 of 4 correct (75%) in 1m35s", "Missed words: Ufer", "25% better than the previous session (50%)"} {
+		if !strings.Contains(msg, expected) {
+			t.Fatalf("Summary should contain %q: %s", expected, msg)
+		}
+	}
+
+	s.previous = nil
+	s.missed = nil
+	msg = formatSummary(s)
+	if strings.Contains(msg, "previous") || strings.Contains(msg, "Missed") {
+		t.Fatalf("Unexpected summary of the first session: %s", msg)
+	}
+}
@@ -0,0 +1,177 @@
+package kindle_quiz_bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bregydoc/gtranslate"
+)
+
+// translationSource is where the accepted translation came from.
+type translationSource string
+
+const (
+	backendTranslation  translationSource = "backend"
+	disputedTranslation translationSource = "dispute"
+)
+
+const (
+	dictionaryURL     = "https://translate.googleapis.com/translate_a/single?client=gtx&sl=%s&tl=%s&dt=bd&q=%s"
+	dictionaryTimeout = 10 * time.Second
+	maxAlternatives   = 5
+)
+
+var (
+	errInvalidDictionary = errors.New("invalid dictionary response")
+	errEmptyTranslation  = errors.New("empty translation")
+)
+
+// translations returns accepted translations of the word, the machine translation goes first.
+// Translations are fetched from the backend once and kept in postgres.
+func (q *quiz) translations(w word, dst *lang) ([]string, error) {
+	accepted, err := q.repo.getAcceptedTranslations(w.id, dst.id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accepted) > 0 {
+		return accepted, nil
+	}
+
+	src, err := q.repo.getLang(w.langId)
+	if err != nil {
+		return nil, err
+	}
+
+	translated, err := gtranslate.TranslateWithParams(
+		w.word,
+		gtranslate.TranslationParams{
+			From:  src.code,
+			To:    dst.code,
+			Delay: time.Second,
+			Tries: 5,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	//Alternatives are optional, the word is still asked without them
+	alternatives, err := fetchAlternatives(w.word, src.code, dst.code)
+	if err != nil {
+		log.Printf("translation alternatives: %v", err)
+	}
+
+	translations := uniqueTranslations(append([]string{translated}, alternatives...))
+	if len(translations) == 0 {
+		return nil, errEmptyTranslation
+	}
+
+	err = q.repo.addAcceptedTranslations(w.id, dst.id, translations, backendTranslation)
+	if err != nil {
+		log.Printf("save translations: %v", err)
+	}
+
+	return translations, nil
+}
+
+// fetchAlternatives returns dictionary translations of the word.
+func fetchAlternatives(text, from, to string) ([]string, error) {
+	client := http.Client{Timeout: dictionaryTimeout}
+
+	resp, err := client.Get(fmt.Sprintf(dictionaryURL, from, to, url.QueryEscape(text)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		//TODO: error handle
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dictionary: status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("dictionary: %v", err.Error())
+	}
+
+	return parseAlternatives(body)
+}
+
+// parseAlternatives reads dictionary entries from the backend response,
+// every entry is a part of speech followed by its translations.
+func parseAlternatives(body []byte) ([]string, error) {
+	var resp []interface{}
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, errInvalidDictionary
+	}
+
+	if len(resp) < 2 || resp[1] == nil {
+		return nil, nil
+	}
+
+	entries, ok := resp[1].([]interface{})
+	if !ok {
+		return nil, errInvalidDictionary
+	}
+
+	alternatives := make([]string, 0)
+	for _, e := range entries {
+		entry, ok := e.([]interface{})
+		if !ok || len(entry) < 2 {
+			return nil, errInvalidDictionary
+		}
+
+		terms, ok := entry[1].([]interface{})
+		if !ok {
+			return nil, errInvalidDictionary
+		}
+
+		for _, t := range terms {
+			if s, ok := t.(string); ok {
+				alternatives = append(alternatives, s)
+			}
+		}
+	}
+
+	alternatives = uniqueTranslations(alternatives)
+	if len(alternatives) > maxAlternatives {
+		alternatives = alternatives[:maxAlternatives]
+	}
+
+	return alternatives, nil
+}
+
+// uniqueTranslations drops empty and repeated translations keeping the order.
+func uniqueTranslations(translations []string) []string {
+	unique := make([]string, 0, len(translations))
+	for _, t := range translations {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+
+		repeated := false
+		for _, u := range unique {
+			if compareWords(t, u) {
+				repeated = true
+				break
+			}
+		}
+
+		if !repeated {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,38 @@
+package kindle_quiz_bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAlternatives(t *testing.T) {
+	body := []byte(`[[["банк","Bank",null,null,1]],[["noun",["банк","скамейка","берег","Банк"],[["банк",["Bank"]]],"Bank",1]],"de"]`)
+
+	alternatives, err := parseAlternatives(body)
+	if err != nil {
+		t.Fatalf("Couldn't parse alternatives: %v", err)
+	}
+
+	expected := []string{"банк", "скамейка", "берег"}
+	if !reflect.DeepEqual(alternatives, expected) {
+		t.Fatalf("Invalid alternatives: %v", alternatives)
+	}
+
+	alternatives, err = parseAlternatives([]byte(`[[["Ufer","Ufer",null,null,1]],null,"de"]`))
+	if err != nil || len(alternatives) != 0 {
+		t.Fatalf("Response without dictionary has no alternatives: %v, %v", alternatives, err)
+	}
+
+	_, err = parseAlternatives([]byte("<html>"))
+	if err != errInvalidDictionary {
+		t.Fatalf("Invalid response should be rejected: %v", err)
+	}
+}
+
+func TestAlternativeIsCorrect(t *testing.T) {
+	p := guessParams{word{word: "Bank", stem: "Bank"}, "берег", 0, forwardDirection, translationQuestion, "ru", 0, noRating}
+	r := guessResult{p, "банк", []string{"скамейка", "берег"}}
+	if !r.correct() || r.answer() != "банк" {
+		t.Fatalf("Alternative translation should be accepted")
+	}
+}
@@ -0,0 +1,209 @@
+package kindle_quiz_bot
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// maxVocabFileSize limits unpacked files, archives let users
+// send files larger than Telegram download limit.
+const maxVocabFileSize = 100 << 20
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// schemaTable is a table with the columns importer reads.
+type schemaTable struct {
+	name    string
+	columns []string
+}
+
+// kindleTables lists vocab.db tables with the columns importer reads.
+var kindleTables = []schemaTable{
+	{"WORDS", []string{"id", "word", "stem", "lang", "category", "timestamp", "profileid"}},
+	{"LOOKUPS", []string{"id", "word_key", "book_key", "pos", "usage", "timestamp"}},
+	{"BOOK_INFO", []string{"id", "asin", "title", "authors", "lang"}},
+}
+
+// validationError is a reason to reject uploaded file, its message is shown to user.
+type validationError struct {
+	reason string
+}
+
+func (e *validationError) Error() string {
+	return e.reason
+}
+
+func invalidFile(format string, a ...interface{}) error {
+	return &validationError{fmt.Sprintf(format, a...)}
+}
+
+// openVocabDB opens vocab.db read-only, immutable flag
+// makes sqlite skip locking and journal files.
+func openVocabDB(path string) (*sql.DB, error) {
+	u := url.URL{Path: path}
+	return sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&immutable=1", u.EscapedPath()))
+}
+
+// validateVocabFile checks uploaded file is e-reader vocabulary database before import,
+// validationError is returned if file is rejected.
+func validateVocabFile(path string) error {
+	err := checkFileSize(path)
+	if err != nil {
+		return err
+	}
+
+	err = checkSQLiteHeader(path)
+	if err != nil {
+		return err
+	}
+
+	db, err := openVocabDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	imp, err := detectImporter(db)
+	if err != nil {
+		return err
+	}
+
+	return imp.validate(db)
+}
+
+// validateUpload detects type of uploaded file and checks it can be imported.
+func validateUpload(path string) (uploadType, error) {
+	err := checkFileSize(path)
+	if err != nil {
+		return unknownUpload, err
+	}
+
+	t, err := detectUploadType(path)
+	if err != nil {
+		return unknownUpload, err
+	}
+
+	switch t {
+	case sqliteUpload:
+		err = validateVocabFile(path)
+	case clippingsUpload:
+		err = validateClippingsFile(path)
+	default:
+		err = invalidFile("Unknown file format. Send vocab.db or My Clippings.txt from your Kindle, KoboReader.sqlite from your Kobo or vocabulary_builder.sqlite3 from KOReader.")
+	}
+
+	return t, err
+}
+
+func checkFileSize(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 {
+		return invalidFile("The file is empty. Copy vocab.db from system/vocabulary folder of your Kindle and send it again.")
+	}
+
+	if info.Size() > maxVocabFileSize {
+		return invalidFile("The file is too large: %d MB, max size is %d MB.", info.Size()>>20, maxVocabFileSize>>20)
+	}
+
+	return nil
+}
+
+func checkSQLiteHeader(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(f, header)
+	if err == io.ErrUnexpectedEOF || err == io.EOF || (err == nil && !bytes.Equal(header, sqliteHeader)) {
+		return invalidFile("The file isn't a SQLite database. Send vocab.db from system/vocabulary folder of your Kindle, KoboReader.sqlite from .kobo folder of your Kobo or vocabulary_builder.sqlite3 from KOReader settings folder.")
+	}
+
+	return err
+}
+
+func checkKindleSchema(db *sql.DB) error {
+	var versions int
+	err := db.QueryRow("SELECT COUNT(*) FROM VERSION WHERE dsname='WORDS'").Scan(&versions)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return invalidFile("The database has no VERSION table, it doesn't look like Kindle vocab.db.")
+		}
+		if strings.Contains(err.Error(), "malformed") || strings.Contains(err.Error(), "not a database") {
+			return invalidFile("The database is corrupted. Copy vocab.db from your Kindle again.")
+		}
+		return err
+	}
+
+	if versions == 0 {
+		return invalidFile("The database has no WORDS version, it doesn't look like Kindle vocab.db.")
+	}
+
+	return checkTables(db, kindleTables, "Kindle vocab.db")
+}
+
+// checkTables checks the database has the tables with their columns,
+// dbName describes the database in validation errors.
+func checkTables(db *sql.DB, tables []schemaTable, dbName string) error {
+	for _, table := range tables {
+		columns, err := tableColumns(db, table.name)
+		if err != nil {
+			return err
+		}
+
+		if len(columns) == 0 {
+			return invalidFile("The database has no %s table, it doesn't look like %s.", table.name, dbName)
+		}
+
+		for _, c := range table.columns {
+			if !columns[strings.ToLower(c)] {
+				return invalidFile("The %s table has no %s column, this %s version isn't supported.", table.name, c, dbName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// tableColumns returns lower-cased column names, empty set if the table doesn't exist.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: table info: %v", err.Error())
+	}
+	defer func() {
+		//TODO: error handle
+		_ = rows.Close()
+	}()
+
+	columns := make(map[string]bool)
+
+	for rows.Next() {
+		err := rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: scan column: %v", err.Error())
+		}
+		columns[strings.ToLower(name)] = true
+	}
+
+	return columns, nil
+}
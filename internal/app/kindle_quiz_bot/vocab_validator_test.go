@@ -0,0 +1,82 @@
+package kindle_quiz_bot
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateVocabFile(t *testing.T) {
+	err := validateVocabFile("../../../test/data/vocab.db")
+	if err != nil {
+		t.Fatalf("Valid vocab.db rejected: %v", err)
+	}
+}
+
+func TestValidateVocabFileRejects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vocab_validator")
+	if err != nil {
+		t.Fatalf("Couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	empty := filepath.Join(dir, "empty.db")
+	err = ioutil.WriteFile(empty, nil, 0600)
+	if err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	text := filepath.Join(dir, "text.db")
+	err = ioutil.WriteFile(text, []byte("<html>Not found</html>"), 0600)
+	if err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	noLookups := filepath.Join(dir, "no_lookups.db")
+	db, err := sql.Open("sqlite3", noLookups)
+	if err != nil {
+		t.Fatalf("Couldn't create db: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE VERSION (id TEXT PRIMARY KEY NOT NULL, dsname TEXT, value INTEGER);
+		INSERT INTO VERSION VALUES ('WORDS', 'WORDS', 1);
+		CREATE TABLE WORDS (id TEXT PRIMARY KEY NOT NULL, word TEXT, stem TEXT, lang TEXT, 
+		                    category INTEGER DEFAULT 0, timestamp INTEGER DEFAULT 0, profileid TEXT);`)
+	_ = db.Close()
+	if err != nil {
+		t.Fatalf("Couldn't create tables: %v", err)
+	}
+
+	cases := []struct {
+		path   string
+		reason string
+	}{
+		{empty, "empty"},
+		{text, "isn't a SQLite database"},
+		{noLookups, "no LOOKUPS table"},
+	}
+
+	for _, c := range cases {
+		err := validateVocabFile(c.path)
+		verr, ok := err.(*validationError)
+		if !ok {
+			t.Fatalf("Expected validation error for %s, got %v", c.path, err)
+		}
+
+		if !strings.Contains(verr.reason, c.reason) {
+			t.Fatalf("Unexpected reason for %s: %s", c.path, verr.reason)
+		}
+	}
+}
+
+func TestValidateOtherDevicesFiles(t *testing.T) {
+	for _, path := range []string{"../../../test/data/KoboReader.sqlite", "../../../test/data/vocabulary_builder.sqlite3"} {
+		err := validateVocabFile(path)
+		if err != nil {
+			t.Fatalf("Valid %s rejected: %v", path, err)
+		}
+	}
+}
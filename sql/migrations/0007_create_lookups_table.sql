@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE lookups (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL,
+    word_id integer NOT NULL,
+    usage text NOT NULL,
+    book_key text,
+    pos text,
+    timestamp bigint DEFAULT 0,
+    FOREIGN KEY (user_id, word_id) REFERENCES user_words ON DELETE CASCADE,
+    UNIQUE (user_id, word_id, usage)
+);
+
+-- +goose Down
+DROP TABLE lookups;
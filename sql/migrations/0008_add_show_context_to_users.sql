@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN show_context boolean DEFAULT true;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN show_context;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE books (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users,
+    book_key text NOT NULL,
+    asin text,
+    title text,
+    authors text,
+    lang text,
+    UNIQUE (user_id, book_key)
+);
+
+CREATE INDEX lookups_book_key_idx ON lookups (user_id, book_key);
+
+ALTER TABLE users ADD COLUMN quiz_book integer REFERENCES books ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN quiz_book;
+DROP INDEX lookups_book_key_idx;
+DROP TABLE books;
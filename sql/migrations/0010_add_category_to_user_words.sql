@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE user_words ADD COLUMN category integer DEFAULT 0;
+ALTER TABLE user_words ADD COLUMN added_at timestamp with time zone;
+
+ALTER TABLE users ADD COLUMN include_mastered boolean DEFAULT false;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN include_mastered;
+
+ALTER TABLE user_words DROP COLUMN added_at;
+ALTER TABLE user_words DROP COLUMN category;
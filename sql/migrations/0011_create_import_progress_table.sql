@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE import_progress (
+    user_id integer REFERENCES users,
+    profile_id text NOT NULL,
+    word_timestamp bigint DEFAULT 0,
+    lookup_timestamp bigint DEFAULT 0,
+    PRIMARY KEY (user_id, profile_id)
+);
+
+-- +goose Down
+DROP TABLE import_progress;
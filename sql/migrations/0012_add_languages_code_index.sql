@@ -0,0 +1,70 @@
+-- +goose Up
+CREATE UNIQUE INDEX languages_code_idx ON languages (code);
+
+-- Words used to be imported with user's target language. Words looked up
+-- in a book of another language are moved onto the words of the book language
+-- with their answers and lookups, other words are kept as they are
+CREATE TEMP TABLE word_moves AS
+SELECT DISTINCT ON (lk.user_id, lk.word_id) lk.user_id, lk.word_id AS old_id, w.word, w.stem, l.id AS lang
+FROM lookups lk
+JOIN words w ON w.id = lk.word_id
+JOIN books b ON b.user_id = lk.user_id AND b.book_key = lk.book_key
+JOIN languages l ON l.code = lower(b.lang)
+WHERE l.id <> w.lang
+ORDER BY lk.user_id, lk.word_id, lk.timestamp DESC;
+
+INSERT INTO words (word, stem, lang)
+SELECT DISTINCT word, stem, lang 
+FROM word_moves
+ON CONFLICT (word, stem, lang) 
+    DO NOTHING;
+
+ALTER TABLE word_moves ADD COLUMN new_id integer;
+
+UPDATE word_moves m 
+SET new_id = w.id 
+FROM words w 
+WHERE w.word = m.word AND w.stem = m.stem AND w.lang = m.lang;
+
+INSERT INTO user_words (user_id, word_id, correct_answers, incorrect_answers, category, added_at)
+SELECT uw.user_id, m.new_id, COALESCE(uw.correct_answers, 0), COALESCE(uw.incorrect_answers, 0), uw.category, uw.added_at
+FROM word_moves m
+JOIN user_words uw ON uw.user_id = m.user_id AND uw.word_id = m.old_id
+ON CONFLICT (user_id, word_id) 
+    DO UPDATE SET correct_answers = COALESCE(user_words.correct_answers, 0) + EXCLUDED.correct_answers, 
+                  incorrect_answers = COALESCE(user_words.incorrect_answers, 0) + EXCLUDED.incorrect_answers, 
+                  category = GREATEST(user_words.category, EXCLUDED.category), 
+                  added_at = LEAST(user_words.added_at, EXCLUDED.added_at);
+
+-- Sentences the word already has with its language are kept once
+DELETE FROM lookups lk
+USING word_moves m, lookups kept
+WHERE lk.user_id = m.user_id AND lk.word_id = m.old_id 
+  AND kept.user_id = m.user_id AND kept.word_id = m.new_id AND kept.usage = lk.usage;
+
+UPDATE lookups lk 
+SET word_id = m.new_id 
+FROM word_moves m 
+WHERE lk.user_id = m.user_id AND lk.word_id = m.old_id;
+
+UPDATE answers a 
+SET word_id = m.new_id 
+FROM word_moves m 
+WHERE a.user_id = m.user_id AND a.word_id = m.old_id;
+
+UPDATE questions q 
+SET word_id = m.new_id 
+FROM word_moves m 
+WHERE q.user_id = m.user_id AND q.word_id = m.old_id;
+
+DELETE FROM user_words uw
+USING word_moves m
+WHERE uw.user_id = m.user_id AND uw.word_id = m.old_id;
+
+DROP TABLE word_moves;
+
+-- Next upload re-imports the words with their own languages
+DELETE FROM import_progress;
+
+-- +goose Down
+DROP INDEX languages_code_idx;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE user_profiles (
+    user_id integer REFERENCES users,
+    profile_id text NOT NULL,
+    selected boolean NOT NULL,
+    PRIMARY KEY (user_id, profile_id)
+);
+
+CREATE TABLE pending_uploads (
+    user_id integer REFERENCES users PRIMARY KEY,
+    path text NOT NULL,
+    profiles text[],
+    created_at timestamp with time zone DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE pending_uploads;
+DROP TABLE user_profiles;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE import_batches (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users,
+    created_at timestamp with time zone DEFAULT now(),
+    file_hash text,
+    words_count integer DEFAULT 0,
+    lookups_count integer DEFAULT 0
+);
+
+ALTER TABLE user_words ADD COLUMN batch_id integer REFERENCES import_batches ON DELETE SET NULL;
+ALTER TABLE lookups ADD COLUMN batch_id integer REFERENCES import_batches ON DELETE SET NULL;
+ALTER TABLE books ADD COLUMN batch_id integer REFERENCES import_batches ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE books DROP COLUMN batch_id;
+ALTER TABLE lookups DROP COLUMN batch_id;
+ALTER TABLE user_words DROP COLUMN batch_id;
+DROP TABLE import_batches;
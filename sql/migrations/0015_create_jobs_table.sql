@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE jobs (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users,
+    kind text NOT NULL,
+    status text NOT NULL DEFAULT 'queued',
+    file_id text,
+    path text,
+    profiles text[],
+    confirmed boolean NOT NULL DEFAULT false,
+    attempts integer NOT NULL DEFAULT 0,
+    error text,
+    created_at timestamp with time zone DEFAULT now(),
+    updated_at timestamp with time zone DEFAULT now()
+);
+
+CREATE INDEX jobs_status_idx ON jobs (kind, status, id);
+
+-- +goose Down
+DROP TABLE jobs;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE word_schedules (
+    user_id integer NOT NULL,
+    word_id integer NOT NULL,
+    direction integer NOT NULL DEFAULT 0,
+    ease real NOT NULL DEFAULT 2.5,
+    interval_days integer NOT NULL DEFAULT 0,
+    repetitions integer NOT NULL DEFAULT 0,
+    due_at timestamp with time zone,
+    correct_answers integer NOT NULL DEFAULT 0,
+    incorrect_answers integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, word_id, direction),
+    FOREIGN KEY (user_id, word_id) REFERENCES user_words ON DELETE CASCADE
+);
+
+CREATE INDEX word_schedules_due_at_idx ON word_schedules (user_id, direction, due_at);
+
+-- +goose Down
+DROP TABLE word_schedules;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN quiz_mode integer NOT NULL DEFAULT 0;
+ALTER TABLE questions ADD COLUMN options text[];
+
+-- +goose Down
+ALTER TABLE questions DROP COLUMN options;
+ALTER TABLE users DROP COLUMN quiz_mode;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN quiz_direction integer NOT NULL DEFAULT 0;
+ALTER TABLE questions ADD COLUMN direction integer NOT NULL DEFAULT 0;
+ALTER TABLE answers ADD COLUMN direction integer NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE answers DROP COLUMN direction;
+ALTER TABLE questions DROP COLUMN direction;
+ALTER TABLE users DROP COLUMN quiz_direction;
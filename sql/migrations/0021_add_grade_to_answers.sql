@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE answers ADD COLUMN grade integer NOT NULL DEFAULT 0;
+UPDATE answers SET grade = 2 WHERE correct;
+
+-- +goose Down
+ALTER TABLE answers DROP COLUMN grade;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE accepted_translations (
+    id SERIAL PRIMARY KEY,
+    word_id integer NOT NULL REFERENCES words ON DELETE CASCADE,
+    lang integer NOT NULL REFERENCES languages,
+    translation text NOT NULL,
+    source text NOT NULL DEFAULT 'backend',
+    created_at timestamp with time zone DEFAULT now(),
+    UNIQUE (word_id, lang, translation)
+);
+
+-- +goose Down
+DROP TABLE accepted_translations;
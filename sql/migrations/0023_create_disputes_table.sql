@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE disputes (
+    id SERIAL PRIMARY KEY,
+    answer_id integer NOT NULL UNIQUE REFERENCES answers ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending',
+    reviewer_id integer REFERENCES users,
+    created_at timestamp with time zone DEFAULT now(),
+    reviewed_at timestamp with time zone
+);
+
+CREATE INDEX disputes_status_idx ON disputes (status, id);
+
+ALTER TABLE users ADD COLUMN is_reviewer boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN is_reviewer;
+DROP TABLE disputes;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE quiz_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users,
+    length integer NOT NULL,
+    status text NOT NULL DEFAULT 'active',
+    started_at timestamp with time zone DEFAULT now(),
+    finished_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX quiz_sessions_active_idx ON quiz_sessions (user_id) WHERE status = 'active';
+
+ALTER TABLE answers ADD COLUMN session_id integer REFERENCES quiz_sessions ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE answers DROP COLUMN session_id;
+DROP TABLE quiz_sessions;
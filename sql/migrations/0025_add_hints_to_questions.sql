@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE questions ADD COLUMN hints integer NOT NULL DEFAULT 0;
+ALTER TABLE answers ADD COLUMN hints integer NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE answers DROP COLUMN hints;
+ALTER TABLE questions DROP COLUMN hints;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE answers ADD COLUMN rating text;
+
+-- +goose Down
+ALTER TABLE answers DROP COLUMN rating;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE word_schedules ADD COLUMN streak integer NOT NULL DEFAULT 0;
+ALTER TABLE word_schedules ADD COLUMN last_answered_at timestamp with time zone;
+ALTER TABLE word_schedules ADD COLUMN retired_at timestamp with time zone;
+ALTER TABLE users ADD COLUMN mastery_threshold integer NOT NULL DEFAULT 8;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN mastery_threshold;
+ALTER TABLE word_schedules DROP COLUMN retired_at;
+ALTER TABLE word_schedules DROP COLUMN last_answered_at;
+ALTER TABLE word_schedules DROP COLUMN streak;